@@ -0,0 +1,204 @@
+package asgard
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+// Errors returned by Authenticators.
+var (
+	// ErrNoCredentials means the request does not carry the credentials an
+	// Authenticator looks for. [FirstOf] tries the next Authenticator on this error.
+	ErrNoCredentials = errors.New("asgard: no client credentials")
+
+	// ErrInvalidCredentials means the request carries malformed or invalid credentials.
+	ErrInvalidCredentials = errors.New("asgard: invalid client credentials")
+
+	// ErrUntrustedProxy means a client certificate header did not come from a trusted proxy.
+	ErrUntrustedProxy = errors.New("asgard: untrusted proxy")
+
+	// ErrNamespaceMismatch means the client certificate belongs to another namespace.
+	ErrNamespaceMismatch = errors.New("asgard: client namespace mismatch")
+
+	// ErrTrustPoolRequired means an Authenticator cannot verify credentials because
+	// no trust pool is set. [DefaultErrorHandler] responds with 503 Service Unavailable.
+	ErrTrustPoolRequired = errors.New("asgard: trust pool required")
+)
+
+// Authenticator authenticates the client of a HTTP request.
+type Authenticator interface {
+	// Authenticate returns the client certificate chain in r, starting with the
+	// client certificate.
+	// It returns an error wrapping [ErrNoCredentials] if r does not carry credentials
+	// of its kind, or another error if it cannot authenticate the client.
+	Authenticate(r *http.Request) ([]*bifrost.Certificate, error)
+}
+
+// AuthenticatorFunc is an adapter to use a function as an [Authenticator].
+type AuthenticatorFunc func(r *http.Request) ([]*bifrost.Certificate, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) ([]*bifrost.Certificate, error) {
+	return f(r)
+}
+
+// ErrorHandler writes the response to a request that failed authentication with err.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// DefaultErrorHandler responds with a 403 Forbidden to clients from other namespaces,
+// a 401 Unauthorized to clients with missing or invalid credentials,
+// and a 503 Service Unavailable otherwise.
+func DefaultErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNamespaceMismatch):
+		http.Error(w, "incorrect namespace", http.StatusForbidden)
+	case errors.Is(err, ErrNoCredentials):
+		http.Error(w, "missing client credentials", http.StatusUnauthorized)
+	case errors.Is(err, ErrUntrustedProxy):
+		http.Error(w, "untrusted proxy", http.StatusUnauthorized)
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, bifrost.ErrCertificateInvalid):
+		http.Error(w, "invalid client credentials", http.StatusUnauthorized)
+	default:
+		http.Error(w, errBadAuthHeader, http.StatusServiceUnavailable)
+	}
+}
+
+// WithErrorHandler returns an Option that makes [Authenticate] respond to
+// authentication failures with h instead of [DefaultErrorHandler].
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(o *options) {
+		o.errorHandler = h
+	}
+}
+
+// Authenticate returns a middleware that authenticates clients with a,
+// and checks that the client certificate belongs to namespace ns.
+// Use [ClientCert] and [ClientCertChain] to get the client certificate and its chain.
+//
+// Requests that fail authentication are answered by the [ErrorHandler] set with
+// [WithErrorHandler], or [DefaultErrorHandler].
+// Namespace mismatches fail with an error wrapping [ErrNamespaceMismatch].
+//
+// Combine Authenticators with [FirstOf] to serve clients that connect directly
+// over mTLS and through a TLS terminating proxy from the same handler.
+func Authenticate(a Authenticator, ns uuid.UUID, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	onError := o.errorHandler
+	if onError == nil {
+		onError = DefaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			certs, err := a.Authenticate(r)
+			if err == nil && len(certs) == 0 {
+				err = fmt.Errorf("%w, no client certificate", ErrInvalidCredentials)
+			}
+			if err == nil && certs[0].Namespace != ns {
+				err = fmt.Errorf("%w, expected %s, got %s",
+					ErrNamespaceMismatch, ns, certs[0].Namespace)
+			}
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "client authentication failed", "error", err)
+				onError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClientCerts(ctx, certs)))
+		})
+	}
+}
+
+// FirstOf returns an Authenticator that tries each of auths in order,
+// until one finds credentials in the request.
+// If none do, it returns an error wrapping [ErrNoCredentials].
+func FirstOf(auths ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) ([]*bifrost.Certificate, error) {
+		for _, a := range auths {
+			certs, err := a.Authenticate(r)
+			if !errors.Is(err, ErrNoCredentials) {
+				return certs, err
+			}
+		}
+		return nil, ErrNoCredentials
+	})
+}
+
+// TLSPeerAuthenticator returns an Authenticator that reads the client certificate chain
+// from the TLS connection. Use this if you are directly serving TLS connections.
+//
+// Requests over connections without TLS or without a client certificate fail with
+// [ErrNoCredentials].
+// With [WithTrustPool], the client certificate must chain up to a CA in the trust pool.
+func TLSPeerAuthenticator(opts ...Option) Authenticator {
+	o := newOptions(opts)
+	return AuthenticatorFunc(func(r *http.Request) ([]*bifrost.Certificate, error) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return nil, ErrNoCredentials
+		}
+		certs, err := o.peerCerts(r.TLS.PeerCertificates)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrInvalidCredentials, err)
+		}
+		return o.verifyChain(certs, time.Now())
+	})
+}
+
+// HeaderAuthenticator returns an Authenticator that reads the client certificate chain
+// from the request header in format h, like [Heimdallr].
+//
+// Requests without the header fail with [ErrNoCredentials].
+// With [WithTrustPool], the client certificate must chain up to a CA in the trust pool.
+// With [WithTrustedProxies], [WithProxyHMAC], or [WithProxyPublicKey], headers from
+// untrusted proxies fail with [ErrUntrustedProxy].
+func HeaderAuthenticator(h HeaderFormat, opts ...Option) Authenticator {
+	o := newOptions(opts)
+	return AuthenticatorFunc(func(r *http.Request) ([]*bifrost.Certificate, error) {
+		if len(r.Header.Values(h.String())) == 0 {
+			return nil, ErrNoCredentials
+		}
+		now := time.Now()
+		if o.enforcesProxyTrust() {
+			if err := o.checkProxy(r, h, now); err != nil {
+				return nil, fmt.Errorf("%w, %w", ErrUntrustedProxy, err)
+			}
+		}
+
+		certs, err := o.headerCerts(h, r.Header)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrInvalidCredentials, err)
+		}
+		return o.verifyChain(certs, now)
+	})
+}
+
+// authenticateChain parses and verifies the client certificate chain sent by a client.
+func (o *options) authenticateChain(
+	chain []*x509.Certificate,
+	at time.Time,
+) ([]*bifrost.Certificate, error) {
+	certs, err := o.parseCerts(chain)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidCredentials, err)
+	}
+	return o.verifyChain(certs, at)
+}
+
+// verifyChain verifies a parsed client certificate chain against the trust pool.
+func (o *options) verifyChain(
+	certs []*bifrost.Certificate,
+	at time.Time,
+) ([]*bifrost.Certificate, error) {
+	certs, err := o.verifyCerts(certs, at)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidCredentials, err)
+	}
+	return certs, nil
+}
@@ -0,0 +1,232 @@
+package asgard
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticate_FirstOf(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+	clientID := key.UUID(ns).String()
+	otherChain := newTestChain(t, uuid.New())
+
+	token, err := SignBearerToken(key, toBifrost(t, chain), "api", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := FirstOf(
+		TLSPeerAuthenticator(),
+		HeaderAuthenticator(HeaderNameClientCert),
+		BearerTokenAuthenticator("api", WithTrustPool(toBifrost(t, chain)[1])),
+	)
+	hdlr := Authenticate(auth, ns)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, ok := ClientCert(r.Context())
+		if !ok {
+			t.Error("expected client certificate in context")
+			return
+		}
+		if certs, ok := ClientCertChain(r.Context()); !ok || len(certs) == 0 {
+			t.Error("expected client certificate chain in context")
+		}
+		_, _ = io.WriteString(w, cert.ID.String())
+	}))
+
+	server := httptest.NewUnstartedServer(hdlr)
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			Certificates:       certs,
+			InsecureSkipVerify: true,
+		}}}
+	}
+	tlsCert := tls.Certificate{
+		Certificate: [][]byte{chain[0].Raw, chain[1].Raw},
+		PrivateKey:  key,
+		Leaf:        chain[0],
+	}
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		setup  func(*http.Request)
+		code   int
+	}{
+		{"tls peer", newClient(tlsCert), func(*http.Request) {}, http.StatusOK},
+		{"header", newClient(), func(r *http.Request) {
+			HeaderNameClientCert.Encode(r.Header, chain)
+		}, http.StatusOK},
+		{"bearer token", newClient(), func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}, http.StatusOK},
+		{"no credentials", newClient(), func(*http.Request) {}, http.StatusUnauthorized},
+		{"invalid bearer token", newClient(), func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token+"x")
+		}, http.StatusUnauthorized},
+		{"wrong namespace", newClient(), func(r *http.Request) {
+			HeaderNameClientCert.Encode(r.Header, otherChain)
+		}, http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.setup(req)
+			resp, err := tc.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.code {
+				t.Fatalf("expected status %d, got %d: %s", tc.code, resp.StatusCode, body)
+			}
+			if tc.code == http.StatusOK && string(body) != clientID {
+				t.Fatalf("expected client %s, got %s", clientID, body)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_errorHandler(t *testing.T) {
+	var gotErr error
+	hdlr := Authenticate(TLSPeerAuthenticator(), uuid.New(), WithErrorHandler(
+		func(w http.ResponseWriter, _ *http.Request, err error) {
+			gotErr = err
+			w.WriteHeader(http.StatusTeapot)
+		},
+	))(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	hdlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("expected status %d, got %d", http.StatusTeapot, w.Code)
+	}
+	if !errors.Is(gotErr, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", gotErr)
+	}
+}
+
+func TestAuthenticate_emptyChain(t *testing.T) {
+	a := AuthenticatorFunc(func(*http.Request) ([]*bifrost.Certificate, error) {
+		return nil, nil
+	})
+	hdlr := Authenticate(a, uuid.New())(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Fatal("handler called without a client certificate")
+	}))
+
+	w := httptest.NewRecorder()
+	hdlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestBearerTokenAuthenticator(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+	certs := toBifrost(t, chain)
+	otherChain, otherKey := newTestClient(t, ns)
+
+	sign := func(aud string, lifetime time.Duration) string {
+		token, err := SignBearerToken(key, certs, aud, lifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// A token signed by another key, carrying the first client's certificate chain.
+	forged, err := SignBearerToken(otherKey, toBifrost(t, otherChain), "api", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := strings.Split(sign("api", time.Minute), ".")
+	forgedParts := strings.Split(forged, ".")
+	forged = valid[0] + "." + forgedParts[1] + "." + forgedParts[2]
+
+	// A token carrying a certificate its signer issued to itself, without the CA.
+	selfCert, selfKey := newTestCA(t, ns)
+	selfSigned, err := SignBearerToken(selfKey, []*bifrost.Certificate{selfCert}, "api", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAuth := func(aud string) Authenticator {
+		return BearerTokenAuthenticator(aud, WithTrustPool(certs[1]))
+	}
+
+	tests := []struct {
+		name  string
+		auth  Authenticator
+		token string
+		err   error
+	}{
+		{"valid", newAuth("api"), sign("api", time.Minute), nil},
+		{"any audience", newAuth(""), sign("", time.Minute), nil},
+		{"untrusted", BearerTokenAuthenticator("api", WithTrustPool(toBifrost(t, otherChain)[1])),
+			sign("api", time.Minute), bifrost.ErrCertificateUntrusted},
+		{"self-signed", newAuth("api"), selfSigned, bifrost.ErrCertificateUntrusted},
+		{"no trust pool", BearerTokenAuthenticator("api"), selfSigned, ErrTrustPoolRequired},
+		{"wrong audience", newAuth("api"), sign("web", time.Minute), ErrInvalidCredentials},
+		{"expired", newAuth("api"), sign("api", -2*time.Minute), ErrInvalidCredentials},
+		{"too long", newAuth("api"), sign("api", time.Hour), ErrInvalidCredentials},
+		{"forged", newAuth("api"), forged, ErrInvalidCredentials},
+		{"malformed", newAuth("api"), "abc", ErrInvalidCredentials},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+			got, err := tc.auth.Authenticate(r)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got[0].IssuedTo(key.PublicKey()) {
+				t.Fatal("expected the client certificate")
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("user", "pass")
+	if _, err := newAuth("").Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+	if _, err := SignBearerToken(otherKey, certs, "", time.Minute); err == nil {
+		t.Fatal("expected error signing with a key that does not match the certificate")
+	}
+}
+
+func toBifrost(t *testing.T, chain []*x509.Certificate) []*bifrost.Certificate {
+	t.Helper()
+	certs := make([]*bifrost.Certificate, len(chain))
+	for i, c := range chain {
+		var err error
+		if certs[i], err = bifrost.NewCertificate(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certs
+}
@@ -0,0 +1,275 @@
+package asgard
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+// MaxBearerTokenLifetime is the longest lifetime of a bearer token accepted by
+// [BearerTokenAuthenticator].
+const MaxBearerTokenLifetime = 15 * time.Minute
+
+// bearerTokenLeeway is the clock skew allowed when checking bearer token times.
+const bearerTokenLeeway = time.Minute
+
+type bearerTokenHeader struct {
+	Alg string   `json:"alg"`
+	Typ string   `json:"typ,omitempty"`
+	X5C []string `json:"x5c"`
+}
+
+type bearerTokenClaims struct {
+	Sub string   `json:"sub,omitempty"`
+	Aud audience `json:"aud,omitempty"`
+	Iat int64    `json:"iat"`
+	Exp int64    `json:"exp"`
+}
+
+// audience is a JWT aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// SignBearerToken returns a bearer token for [BearerTokenAuthenticator].
+// The token is a JWT signed by key, carrying the certificate chain of key in its x5c header,
+// and is valid for lifetime from now.
+// chain must start with the client certificate issued to key.
+// If aud is not empty, the token is only accepted by servers expecting that audience.
+func SignBearerToken(
+	key *bifrost.PrivateKey,
+	chain []*bifrost.Certificate,
+	aud string,
+	lifetime time.Duration,
+) (string, error) {
+	if len(chain) == 0 || !chain[0].IssuedTo(key.PublicKey()) {
+		return "", errors.New("asgard: certificate chain does not belong to key")
+	}
+	alg, hash, err := jwsAlgorithm(key.Public())
+	if err != nil {
+		return "", err
+	}
+
+	header := bearerTokenHeader{Alg: alg, Typ: "JWT"}
+	for _, c := range chain {
+		header.X5C = append(header.X5C, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	now := time.Now()
+	claims := bearerTokenClaims{
+		Sub: chain[0].ID.String(),
+		Iat: now.Unix(),
+		Exp: now.Add(lifetime).Unix(),
+	}
+	if aud != "" {
+		claims.Aud = audience{aud}
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." +
+		base64.RawURLEncoding.EncodeToString(c)
+
+	digest := []byte(signingInput)
+	if hash != 0 {
+		hh := hash.New()
+		hh.Write(digest)
+		digest = hh.Sum(nil)
+	}
+	sig, err := key.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", err
+	}
+	if k, ok := key.Public().(*ecdsa.PublicKey); ok {
+		if sig, err = ecdsaRawSignature(k, sig); err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// BearerTokenAuthenticator returns an Authenticator that reads a bearer token made by
+// [SignBearerToken] from the Authorization header.
+// The token must be signed by the private key of the client certificate in its x5c header,
+// be valid now, and live no longer than [MaxBearerTokenLifetime].
+// If aud is not empty, the token audience must include aud.
+//
+// Requests without a bearer token fail with [ErrNoCredentials].
+// The client certificate must chain up to a CA set with [WithTrustPool] through the
+// intermediates in the token. Clients make their own tokens, so without a trust pool anyone
+// could sign a token with a self-signed certificate; every token then fails with
+// [ErrTrustPoolRequired].
+// Bearer tokens can be replayed until they expire, so keep their lifetime short.
+func BearerTokenAuthenticator(aud string, opts ...Option) Authenticator {
+	o := newOptions(opts)
+	return AuthenticatorFunc(func(r *http.Request) ([]*bifrost.Certificate, error) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, ErrNoCredentials
+		}
+		if len(o.trustPool) == 0 {
+			return nil, ErrTrustPoolRequired
+		}
+		certs, err := o.parseBearerToken(strings.TrimSpace(token), aud, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrInvalidCredentials, err)
+		}
+		return certs, nil
+	})
+}
+
+func (o *options) parseBearerToken(token, aud string, now time.Time) ([]*bifrost.Certificate, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed bearer token")
+	}
+
+	var header bearerTokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid bearer token header: %w", err)
+	}
+	if len(header.X5C) == 0 {
+		return nil, errors.New("bearer token has no certificate chain")
+	}
+	chain := make([]*x509.Certificate, len(header.X5C))
+	for i, enc := range header.X5C {
+		der, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bearer token certificate: %w", err)
+		}
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("invalid bearer token certificate: %w", err)
+		}
+	}
+	certs, err := o.authenticateChain(chain, now)
+	if err != nil {
+		return nil, err
+	}
+	cert := certs[0]
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid bearer token signature: %w", err)
+	}
+	if !verifyJWS(cert.PublicKey, header.Alg, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, errors.New("invalid bearer token signature")
+	}
+
+	var claims bearerTokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid bearer token claims: %w", err)
+	}
+	iat, exp := time.Unix(claims.Iat, 0), time.Unix(claims.Exp, 0)
+	switch {
+	case claims.Exp == 0 || claims.Iat == 0:
+		return nil, errors.New("bearer token has no expiry")
+	case !now.Before(exp.Add(bearerTokenLeeway)):
+		return nil, fmt.Errorf("bearer token expired at %s", exp)
+	case iat.After(now.Add(bearerTokenLeeway)):
+		return nil, fmt.Errorf("bearer token issued in the future at %s", iat)
+	case exp.Sub(iat) > MaxBearerTokenLifetime:
+		return nil, fmt.Errorf("bearer token lifetime %s is too long", exp.Sub(iat))
+	}
+	if claims.Sub != "" {
+		if sub, err := uuid.Parse(claims.Sub); err != nil || sub != cert.ID {
+			return nil, fmt.Errorf("bearer token subject %s does not match certificate", claims.Sub)
+		}
+	}
+	if aud != "" && !slices.Contains(claims.Aud, aud) {
+		return nil, fmt.Errorf("bearer token is not for audience %s", aud)
+	}
+	return certs, nil
+}
+
+func decodeTokenPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwsAlgorithm returns the JWS algorithm and hash for signing with pub.
+func jwsAlgorithm(pub crypto.PublicKey) (string, crypto.Hash, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return "ES256", crypto.SHA256, nil
+		case 384:
+			return "ES384", crypto.SHA384, nil
+		}
+	case ed25519.PublicKey:
+		return "EdDSA", crypto.Hash(0), nil
+	}
+	return "", 0, fmt.Errorf("asgard: unsupported bearer token key type %T", pub)
+}
+
+func verifyJWS(pub *bifrost.PublicKey, alg string, signingInput, sig []byte) bool {
+	want, hash, err := jwsAlgorithm(pub.PublicKey)
+	if err != nil || alg != want {
+		return false
+	}
+	switch k := pub.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		h := hash.New()
+		h.Write(signingInput)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, h.Sum(nil), r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, signingInput, sig)
+	}
+	return false
+}
+
+// ecdsaRawSignature converts an ASN.1 ECDSA signature to the fixed size R || S form used by JWS.
+func ecdsaRawSignature(pub *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	rs.R.FillBytes(raw[:size])
+	rs.S.FillBytes(raw[size:])
+	return raw, nil
+}
@@ -0,0 +1,179 @@
+package asgard
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// WithCertCache returns an Option that caches up to size parsed client certificate
+// chains, so that clients reusing a certificate are not parsed again on every request.
+// Chains are keyed by a hash of the raw header value or TLS peer certificates,
+// and evicted when the least recently used or when a certificate in them expires.
+// Cache hits and misses are counted in the bifrost_asgard_cert_cache_hits_total and
+// bifrost_asgard_cert_cache_misses_total metrics.
+func WithCertCache(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.certCache = newCertCache(size)
+		}
+	}
+}
+
+type cacheKey [sha256.Size]byte
+
+// certCache is a least recently used cache of parsed certificate chains.
+type certCache struct {
+	size   int
+	hits   *metrics.Counter
+	misses *metrics.Counter
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[cacheKey]*list.Element
+}
+
+type certCacheEntry struct {
+	key     cacheKey
+	certs   []*bifrost.Certificate
+	expires time.Time
+}
+
+func newCertCache(size int) *certCache {
+	return &certCache{
+		size:   size,
+		hits:   bifrost.StatsForNerds.GetOrCreateCounter("bifrost_asgard_cert_cache_hits_total"),
+		misses: bifrost.StatsForNerds.GetOrCreateCounter("bifrost_asgard_cert_cache_misses_total"),
+		ll:     list.New(),
+		items:  make(map[cacheKey]*list.Element, size),
+	}
+}
+
+// get returns the cached chain for key, unless it has expired at time now.
+func (c *certCache) get(key cacheKey, now time.Time) ([]*bifrost.Certificate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Inc()
+		return nil, false
+	}
+	e := el.Value.(*certCacheEntry)
+	if now.After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.misses.Inc()
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits.Inc()
+	return e.certs, true
+}
+
+// add caches certs under key until the first certificate in certs expires.
+func (c *certCache) add(key cacheKey, certs []*bifrost.Certificate) {
+	expires := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(expires) {
+			expires = cert.NotAfter
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value = &certCacheEntry{key: key, certs: certs, expires: expires}
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&certCacheEntry{key: key, certs: certs, expires: expires})
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*certCacheEntry).key)
+	}
+}
+
+// cachedCerts returns the chain cached under key, or calls parse and caches its result.
+// Without a cache, it calls parse.
+func (o *options) cachedCerts(
+	key func() cacheKey,
+	parse func() ([]*bifrost.Certificate, error),
+) ([]*bifrost.Certificate, error) {
+	if o.certCache == nil {
+		return parse()
+	}
+	k := key()
+	if certs, ok := o.certCache.get(k, time.Now()); ok {
+		return certs, nil
+	}
+	certs, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	o.certCache.add(k, certs)
+	return certs, nil
+}
+
+// headerCerts decodes and parses the client certificate chain in the h header of hdr.
+func (o *options) headerCerts(h HeaderFormat, hdr http.Header) ([]*bifrost.Certificate, error) {
+	return o.cachedCerts(
+		func() cacheKey { return headerCacheKey(h, hdr) },
+		func() ([]*bifrost.Certificate, error) {
+			chain, err := h.Decode(hdr)
+			if err == nil && len(chain) == 0 {
+				err = errNoCertHeader
+			}
+			if err != nil {
+				return nil, err
+			}
+			return o.parseCerts(chain)
+		},
+	)
+}
+
+// peerCerts parses the TLS peer certificate chain.
+func (o *options) peerCerts(chain []*x509.Certificate) ([]*bifrost.Certificate, error) {
+	return o.cachedCerts(
+		func() cacheKey { return chainCacheKey(chain) },
+		func() ([]*bifrost.Certificate, error) { return o.parseCerts(chain) },
+	)
+}
+
+func headerCacheKey(h HeaderFormat, hdr http.Header) cacheKey {
+	return stringsCacheKey("header", append([]string{h.String()}, hdr.Values(h.String())...)...)
+}
+
+// stringsCacheKey returns the cache key of values from source.
+func stringsCacheKey(source string, values ...string) cacheKey {
+	hash := sha256.New()
+	hash.Write([]byte(source + "\x00"))
+	for _, v := range values {
+		writeLengthPrefixed(hash, []byte(v))
+	}
+	return cacheKey(hash.Sum(nil))
+}
+
+func chainCacheKey(chain []*x509.Certificate) cacheKey {
+	hash := sha256.New()
+	hash.Write([]byte("chain\x00"))
+	for _, c := range chain {
+		writeLengthPrefixed(hash, c.Raw)
+	}
+	return cacheKey(hash.Sum(nil))
+}
+
+func writeLengthPrefixed(w io.Writer, b []byte) {
+	_, _ = w.Write(binary.BigEndian.AppendUint64(nil, uint64(len(b))))
+	_, _ = w.Write(b)
+}
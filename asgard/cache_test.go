@@ -0,0 +1,98 @@
+package asgard
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+func TestCertCache(t *testing.T) {
+	c := newCertCache(2)
+	now := time.Now()
+	newCerts := func(notAfter time.Time) []*bifrost.Certificate {
+		return []*bifrost.Certificate{{Certificate: &x509.Certificate{NotAfter: notAfter}}}
+	}
+	k1, k2, k3 := cacheKey{1}, cacheKey{2}, cacheKey{3}
+
+	c.add(k1, newCerts(now.Add(time.Hour)))
+	c.add(k2, newCerts(now.Add(time.Hour)))
+	if _, ok := c.get(k1, now); !ok {
+		t.Fatal("expected k1 in cache")
+	}
+
+	// k2 is the least recently used entry.
+	c.add(k3, newCerts(now.Add(time.Hour)))
+	if _, ok := c.get(k2, now); ok {
+		t.Fatal("expected k2 to be evicted")
+	}
+	if _, ok := c.get(k1, now); !ok {
+		t.Fatal("expected k1 in cache")
+	}
+
+	// Entries expire with the first certificate in the chain to expire.
+	chain := append(newCerts(now.Add(time.Hour)), newCerts(now.Add(time.Minute))...)
+	c.add(k1, chain)
+	if _, ok := c.get(k1, now.Add(2*time.Minute)); ok {
+		t.Fatal("expected expired entry to be evicted")
+	}
+	if c.ll.Len() != 1 || len(c.items) != 1 {
+		t.Fatalf("expected 1 entry, got %d", c.ll.Len())
+	}
+}
+
+func TestHeimdallr_certCache(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+	hits := bifrost.StatsForNerds.GetOrCreateCounter("bifrost_asgard_cert_cache_hits_total")
+	misses := bifrost.StatsForNerds.GetOrCreateCounter("bifrost_asgard_cert_cache_misses_total")
+	hits0, misses0 := hits.Get(), misses.Get()
+
+	hdlr := Heimdallr(HeaderNameClientCert, ns, WithTrustPool(toBifrost(t, chain)[1]), WithCertCache(10))(
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			if _, ok := ClientCert(r.Context()); !ok {
+				t.Error("expected client certificate in context")
+			}
+		}))
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		HeaderNameClientCert.Encode(req.Header, chain)
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+
+	if h, m := hits.Get()-hits0, misses.Get()-misses0; h != 2 || m != 1 {
+		t.Fatalf("expected 2 hits and 1 miss, got %d hits and %d misses", h, m)
+	}
+}
+
+func BenchmarkHeimdallr(b *testing.B) {
+	ns := uuid.New()
+	chain := newTestChain(b, ns)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	HeaderNameClientCert.Encode(req.Header, chain)
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{"uncached", nil},
+		{"cached", []Option{WithCertCache(1024)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			hdlr := Heimdallr(HeaderNameClientCert, ns, bm.opts...)(next)
+			b.ReportAllocs()
+			for b.Loop() {
+				hdlr.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package asgard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// ErrIdentityNotFound is returned by a [Directory] that has no entry for an identity.
+var ErrIdentityNotFound = errors.New("asgard: identity not found")
+
+// DirectoryEntry holds the attributes of a client identity.
+// DirectoryEntry implements the DynamoDB Marshaler and Unmarshaler interfaces,
+// and is stored with id and namespace string attributes.
+type DirectoryEntry struct {
+	ID        uuid.UUID `json:"id"                  yaml:"id"`
+	Namespace uuid.UUID `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	Name       string            `json:"name,omitempty"       yaml:"name,omitempty"`
+	Roles      []string          `json:"roles,omitempty"      yaml:"roles,omitempty"`
+	Tenant     string            `json:"tenant,omitempty"     yaml:"tenant,omitempty"`
+	Disabled   bool              `json:"disabled,omitempty"   yaml:"disabled,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+
+	// Identity, if set, is the identity the client certificate must be issued to.
+	Identity *bifrost.Identity `json:"identity,omitempty" yaml:"identity,omitempty"`
+}
+
+// directoryEntryDoc is the DynamoDB representation of a directory entry.
+type directoryEntryDoc struct {
+	ID         string            `dynamodbav:"id"`
+	Namespace  string            `dynamodbav:"namespace,omitempty"`
+	Name       string            `dynamodbav:"name,omitempty"`
+	Roles      []string          `dynamodbav:"roles,omitempty,stringset"`
+	Tenant     string            `dynamodbav:"tenant,omitempty"`
+	Disabled   bool              `dynamodbav:"disabled,omitempty"`
+	Attributes map[string]string `dynamodbav:"attributes,omitempty"`
+	Identity   *bifrost.Identity `dynamodbav:"identity,omitempty"`
+}
+
+// MarshalDynamoDBAttributeValue marshals the entry to a map.
+func (e DirectoryEntry) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	doc := directoryEntryDoc{
+		ID:         e.ID.String(),
+		Name:       e.Name,
+		Roles:      e.Roles,
+		Tenant:     e.Tenant,
+		Disabled:   e.Disabled,
+		Attributes: e.Attributes,
+		Identity:   e.Identity,
+	}
+	if e.Namespace != uuid.Nil {
+		doc.Namespace = e.Namespace.String()
+	}
+	return attributevalue.Marshal(doc)
+}
+
+// UnmarshalDynamoDBAttributeValue unmarshals the entry from a map.
+func (e *DirectoryEntry) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var doc directoryEntryDoc
+	if err := attributevalue.Unmarshal(av, &doc); err != nil {
+		return err
+	}
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return fmt.Errorf("asgard: invalid directory entry id: %w", err)
+	}
+	var ns uuid.UUID
+	if doc.Namespace != "" {
+		if ns, err = uuid.Parse(doc.Namespace); err != nil {
+			return fmt.Errorf("asgard: invalid directory entry namespace: %w", err)
+		}
+	}
+	*e = DirectoryEntry{
+		ID:         id,
+		Namespace:  ns,
+		Name:       doc.Name,
+		Roles:      doc.Roles,
+		Tenant:     doc.Tenant,
+		Disabled:   doc.Disabled,
+		Attributes: doc.Attributes,
+		Identity:   doc.Identity,
+	}
+	return nil
+}
+
+// Directory resolves client identities to their attributes.
+type Directory interface {
+	// Lookup returns the entry for identity id in namespace ns.
+	// It returns an error wrapping ErrIdentityNotFound if there is no entry.
+	Lookup(ctx context.Context, ns, id uuid.UUID) (*DirectoryEntry, error)
+}
+
+// StaticDirectory is a [Directory] of a fixed set of entries.
+type StaticDirectory map[uuid.UUID]*DirectoryEntry
+
+// LoadDirectoryFile returns a [StaticDirectory] of the entries in the YAML or JSON file name,
+// which holds a list of entries.
+// Unknown fields are errors, so that a misspelled field like disabled is not ignored.
+func LoadDirectoryFile(name string) (StaticDirectory, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*DirectoryEntry
+	if err := decodeYAML(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing directory file: %w", err)
+	}
+
+	d := make(StaticDirectory, len(entries))
+	for i, e := range entries {
+		if e == nil || e.ID == uuid.Nil {
+			return nil, fmt.Errorf("directory entry %d has no id", i)
+		}
+		if _, ok := d[e.ID]; ok {
+			return nil, fmt.Errorf("duplicate directory entry %s", e.ID)
+		}
+		d[e.ID] = e
+	}
+	return d, nil
+}
+
+// Lookup returns the entry for id, if its namespace is ns or unset.
+func (d StaticDirectory) Lookup(_ context.Context, ns, id uuid.UUID) (*DirectoryEntry, error) {
+	e, ok := d[id]
+	if !ok || (e.Namespace != uuid.Nil && e.Namespace != ns) {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityNotFound, id)
+	}
+	return e, nil
+}
+
+// DynamoDBGetItemAPI is the part of the DynamoDB client used by [DynamoDBDirectory].
+type DynamoDBGetItemAPI interface {
+	GetItem(
+		ctx context.Context,
+		params *dynamodb.GetItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDBDirectory is a [Directory] backed by a DynamoDB table
+// with a string partition key named id.
+type DynamoDBDirectory struct {
+	Client DynamoDBGetItemAPI
+	Table  string
+}
+
+// Lookup gets the entry for id from the table, if its namespace is ns or unset.
+func (d *DynamoDBDirectory) Lookup(ctx context.Context, ns, id uuid.UUID) (*DirectoryEntry, error) {
+	out, err := d.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.Table),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id.String()},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory entry: %w", err)
+	}
+	if out.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityNotFound, id)
+	}
+
+	var e DirectoryEntry
+	if err := attributevalue.UnmarshalMap(out.Item, &e); err != nil {
+		return nil, err
+	}
+	if e.Namespace != uuid.Nil && e.Namespace != ns {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityNotFound, id)
+	}
+	return &e, nil
+}
+
+// CachedDirectory returns a [Directory] that caches lookups from d for ttl,
+// including identities that are not found.
+// At most size lookups are cached.
+func CachedDirectory(d Directory, ttl time.Duration, size int) Directory {
+	return &cachedDirectory{
+		d:       d,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[[2]uuid.UUID]cachedLookup),
+	}
+}
+
+type cachedDirectory struct {
+	d    Directory
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[[2]uuid.UUID]cachedLookup
+}
+
+type cachedLookup struct {
+	entry   *DirectoryEntry
+	err     error
+	expires time.Time
+}
+
+func (c *cachedDirectory) Lookup(ctx context.Context, ns, id uuid.UUID) (*DirectoryEntry, error) {
+	key := [2]uuid.UUID{ns, id}
+	now := time.Now()
+
+	c.mu.Lock()
+	l, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(l.expires) {
+		return l.entry, l.err
+	}
+
+	entry, err := c.d.Lookup(ctx, ns, id)
+	if err != nil && !errors.Is(err, ErrIdentityNotFound) {
+		// Don't cache lookup failures.
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		for k, v := range c.entries {
+			if !now.Before(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Evict an arbitrary entry if none have expired.
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	if c.size > 0 {
+		c.entries[key] = cachedLookup{entry: entry, err: err, expires: now.Add(c.ttl)}
+	}
+	return entry, err
+}
+
+type keyDirectoryEntry struct{}
+
+// ClientEntry returns the directory entry of the client from the request context.
+// If the entry is not present, the second return value is false.
+// Use this function to access client attributes in a HTTP handler
+// that has been wrapped with [ResolveIdentity].
+func ClientEntry(ctx context.Context) (*DirectoryEntry, bool) {
+	e, ok := ctx.Value(keyDirectoryEntry{}).(*DirectoryEntry)
+	return e, ok
+}
+
+// ResolveIdentity returns a middleware that looks up the client identity in d,
+// and puts its entry in the request context.
+// It must run after Heimdallr or Hofund, which put the client certificate in the request context.
+//
+// Requests without a client certificate get a 401 Unauthorized.
+// Identities that are not in the directory, are disabled, or whose entry is pinned to a
+// different public key get a 403 Forbidden.
+// If the directory lookup fails, the middleware responds with a 503 Service Unavailable.
+func ResolveIdentity(d Directory) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			cert, ok := ClientCert(ctx)
+			if !ok {
+				bifrost.Logger().ErrorContext(ctx, "no client certificate to resolve")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			entry, err := d.Lookup(ctx, cert.Namespace, cert.ID)
+			switch {
+			case errors.Is(err, ErrIdentityNotFound):
+				bifrost.Logger().ErrorContext(ctx, "unknown client identity", "id", cert.ID)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			case err != nil:
+				bifrost.Logger().ErrorContext(ctx, "error looking up client identity",
+					"id", cert.ID, "error", err)
+				http.Error(w, "directory unavailable", http.StatusServiceUnavailable)
+				return
+			case entry.Disabled:
+				bifrost.Logger().ErrorContext(ctx, "disabled client identity", "id", cert.ID)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			case entry.Identity != nil && !cert.IssuedTo(entry.Identity.PublicKey):
+				bifrost.Logger().ErrorContext(ctx, "client public key does not match directory",
+					"id", cert.ID)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx = context.WithValue(ctx, keyDirectoryEntry{}, entry)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
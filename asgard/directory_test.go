@@ -0,0 +1,234 @@
+package asgard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+type fakeGetItem struct {
+	items map[string]map[string]types.AttributeValue
+	err   error
+	calls int
+}
+
+func (f *fakeGetItem) GetItem(
+	_ context.Context,
+	in *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	id := in.Key["id"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: f.items[id]}, nil
+}
+
+func TestDynamoDBDirectory(t *testing.T) {
+	ns := uuid.New()
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := &bifrost.Identity{Namespace: ns, PublicKey: key.PublicKey()}
+	entry := DirectoryEntry{
+		ID:         id.UUID(),
+		Namespace:  ns,
+		Name:       "printer",
+		Roles:      []string{"reader", "writer"},
+		Tenant:     "acme",
+		Attributes: map[string]string{"site": "hq"},
+		Identity:   id,
+	}
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := item["id"].(*types.AttributeValueMemberS); !ok || s.Value != entry.ID.String() {
+		t.Fatalf("expected string id attribute, got %#v", item["id"])
+	}
+
+	d := &DynamoDBDirectory{
+		Client: &fakeGetItem{items: map[string]map[string]types.AttributeValue{
+			entry.ID.String(): item,
+		}},
+		Table: "directory",
+	}
+	got, err := d.Lookup(context.Background(), ns, entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != entry.ID || got.Namespace != ns || got.Name != entry.Name ||
+		got.Tenant != entry.Tenant || len(got.Roles) != 2 || got.Attributes["site"] != "hq" ||
+		got.Identity == nil || !got.Identity.PublicKey.Equal(key.PublicKey()) {
+		t.Fatalf("unexpected entry %+v", got)
+	}
+
+	if _, err := d.Lookup(context.Background(), uuid.New(), entry.ID); !errors.Is(err, ErrIdentityNotFound) {
+		t.Fatalf("expected ErrIdentityNotFound for another namespace, got %v", err)
+	}
+	if _, err := d.Lookup(context.Background(), ns, uuid.New()); !errors.Is(err, ErrIdentityNotFound) {
+		t.Fatalf("expected ErrIdentityNotFound, got %v", err)
+	}
+}
+
+func TestLoadDirectoryFile(t *testing.T) {
+	ns := uuid.New()
+	id := uuid.New()
+	name := filepath.Join(t.TempDir(), "directory.yaml")
+	data := "- id: " + id.String() + "\n" +
+		"  namespace: " + ns.String() + "\n" +
+		"  name: printer\n" +
+		"  roles: [reader]\n" +
+		"  disabled: true\n"
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDirectoryFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := d.Lookup(context.Background(), ns, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "printer" || !e.Disabled || len(e.Roles) != 1 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	dup := "[{id: " + id.String() + "}, {id: " + id.String() + "}]"
+	if err := os.WriteFile(name, []byte(dup), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDirectoryFile(name); err == nil {
+		t.Fatal("expected error for duplicate entries")
+	}
+
+	typo := "[{id: " + id.String() + ", disable: true}]"
+	if err := os.WriteFile(name, []byte(typo), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDirectoryFile(name); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestCachedDirectory(t *testing.T) {
+	ns := uuid.New()
+	id := uuid.New()
+	item, err := attributevalue.MarshalMap(DirectoryEntry{ID: id, Name: "printer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeGetItem{items: map[string]map[string]types.AttributeValue{id.String(): item}}
+	d := CachedDirectory(&DynamoDBDirectory{Client: client}, time.Minute, 10)
+
+	missing := uuid.New()
+	for range 3 {
+		if _, err := d.Lookup(context.Background(), ns, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Lookup(context.Background(), ns, missing); !errors.Is(err, ErrIdentityNotFound) {
+			t.Fatalf("expected ErrIdentityNotFound, got %v", err)
+		}
+	}
+	if client.calls != 2 {
+		t.Fatalf("expected 2 lookups, got %d", client.calls)
+	}
+
+	// Lookup failures are not cached.
+	client.err = errors.New("boom")
+	if _, err := d.Lookup(context.Background(), ns, uuid.New()); err == nil {
+		t.Fatal("expected error")
+	}
+	client.err = nil
+	if _, err := d.Lookup(context.Background(), ns, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveIdentity(t *testing.T) {
+	ns := uuid.New()
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert := func(key *bifrost.PrivateKey) *bifrost.Certificate {
+		return &bifrost.Certificate{Namespace: ns, ID: key.UUID(ns), PublicKey: key.PublicKey()}
+	}
+
+	disabled, pinned := uuid.New(), otherKey.UUID(ns)
+	d := StaticDirectory{
+		key.UUID(ns): {ID: key.UUID(ns), Name: "printer", Tenant: "acme"},
+		disabled:     {ID: disabled, Disabled: true},
+		pinned: {ID: pinned, Identity: &bifrost.Identity{
+			Namespace: ns,
+			PublicKey: key.PublicKey(),
+		}},
+	}
+
+	var got *DirectoryEntry
+	handler := ResolveIdentity(d)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got, _ = ClientEntry(r.Context())
+	}))
+	serve := func(cert *bifrost.Certificate) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			req = req.WithContext(context.WithValue(req.Context(), keyClientCert{}, cert))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(newCert(key)); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if got == nil || got.Name != "printer" || got.Tenant != "acme" {
+		t.Fatalf("unexpected entry in context %+v", got)
+	}
+
+	tests := []struct {
+		name string
+		cert *bifrost.Certificate
+		code int
+	}{
+		{"no certificate", nil, http.StatusUnauthorized},
+		{"unknown", &bifrost.Certificate{Namespace: ns, ID: uuid.New()}, http.StatusForbidden},
+		{"disabled", &bifrost.Certificate{Namespace: ns, ID: disabled}, http.StatusForbidden},
+		{"pinned key mismatch", newCert(otherKey), http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := serve(tc.cert); code != tc.code {
+				t.Fatalf("expected status %d, got %d", tc.code, code)
+			}
+		})
+	}
+
+	failing := ResolveIdentity(&DynamoDBDirectory{Client: &fakeGetItem{err: errors.New("boom")}})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), keyClientCert{}, newCert(key)))
+	failing(http.NotFoundHandler()).ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
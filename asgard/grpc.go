@@ -0,0 +1,110 @@
+package asgard
+
+import (
+	"context"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor that validates the client certificate
+// presented in the TLS handshake, like Hofund does for HTTP servers.
+//
+// If a certificate is not found or is invalid, the interceptor returns an
+// Unauthenticated error.
+// If the certificate namespace does not match ns, it returns a PermissionDenied error.
+// With [WithTrustPool], the certificate must also chain up to a CA in the trust pool
+// through the intermediates sent by the client.
+//
+// Use [ClientCert] and [ClientCertChain] to get the client certificate and its chain
+// in gRPC method handlers.
+func UnaryServerInterceptor(ns uuid.UUID, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := o.authenticatePeer(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream interceptor that validates the client
+// certificate presented in the TLS handshake.
+// See [UnaryServerInterceptor].
+func StreamServerInterceptor(ns uuid.UUID, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := o.authenticatePeer(ss.Context(), ns)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticatePeer validates the client certificate of the gRPC peer in ctx,
+// and returns a context holding the certificate and its chain.
+func (o *options) authenticatePeer(ctx context.Context, ns uuid.UUID) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer information")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no client certificate")
+	}
+
+	certs, err := o.peerCerts(tlsInfo.State.PeerCertificates)
+	if err != nil {
+		bifrost.Logger().ErrorContext(ctx, "error validating client certificate", "error", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid client certificate")
+	}
+	cert := certs[0]
+
+	if certs, err = o.verifyCerts(certs, time.Now()); err != nil {
+		bifrost.Logger().ErrorContext(
+			ctx, "client certificate rejected",
+			"reason", rejectReason(err),
+			"error", err,
+		)
+		return nil, status.Error(codes.Unauthenticated, "invalid client certificate")
+	}
+
+	if cert.Namespace != ns {
+		bifrost.Logger().ErrorContext(
+			ctx, "client certificate namespace mismatch",
+			"expected", ns,
+			"actual", cert.Namespace,
+		)
+		return nil, status.Error(codes.PermissionDenied, "incorrect namespace")
+	}
+
+	return withClientCerts(ctx, certs), nil
+}
@@ -0,0 +1,194 @@
+package asgard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/RealImage/bifrost/tinyca"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// certHealthServer reports SERVING to clients with a bifrost certificate in namespace ns.
+type certHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	ns uuid.UUID
+}
+
+func (s *certHealthServer) status(ctx context.Context) *healthpb.HealthCheckResponse {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if cert, ok := ClientCert(ctx); ok && cert.Namespace == s.ns {
+		if chain, ok := ClientCertChain(ctx); ok && len(chain) != 0 {
+			st = healthpb.HealthCheckResponse_SERVING
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: st}
+}
+
+func (s *certHealthServer) Check(
+	ctx context.Context,
+	_ *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	return s.status(ctx), nil
+}
+
+func (s *certHealthServer) Watch(
+	_ *healthpb.HealthCheckRequest,
+	stream grpc.ServerStreamingServer[healthpb.HealthCheckResponse],
+) error {
+	return stream.Send(s.status(stream.Context()))
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	ns := uuid.New()
+	caCert, caKey := newTestCA(t, ns)
+	ca, err := tinyca.New(caCert, caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+	mux := http.NewServeMux()
+	ca.AddRoutes(mux, false)
+	caServer := httptest.NewServer(mux)
+	defer caServer.Close()
+
+	serverCert, roots := newTestServerCert(t)
+	newServer := func(serverNS uuid.UUID, clientAuth tls.ClientAuthType) string {
+		creds := credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   clientAuth,
+		})
+		s := grpc.NewServer(
+			grpc.Creds(creds),
+			grpc.UnaryInterceptor(UnaryServerInterceptor(serverNS)),
+			grpc.StreamInterceptor(StreamServerInterceptor(serverNS)),
+		)
+		healthpb.RegisterHealthServer(s, &certHealthServer{ns: serverNS})
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = s.Serve(lis) }()
+		t.Cleanup(s.Stop)
+		return lis.Addr().String()
+	}
+	dial := func(addr string, creds credentials.TransportCredentials) healthpb.HealthClient {
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return healthpb.NewHealthClient(conn)
+	}
+
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clientCreds, err := bifrost.TransportCredentials(
+		ctx, caServer.URL, key, bifrost.WithRootCAs(roots))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := dial(newServer(ns, tls.RequireAnyClientCert), clientCreds)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("unary: expected SERVING, got %s", resp.Status)
+	}
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("stream: expected SERVING, got %s", resp.Status)
+	}
+
+	tests := []struct {
+		name  string
+		addr  string
+		creds credentials.TransportCredentials
+		code  codes.Code
+	}{
+		{
+			name:  "wrong namespace",
+			addr:  newServer(uuid.New(), tls.RequireAnyClientCert),
+			creds: clientCreds,
+			code:  codes.PermissionDenied,
+		},
+		{
+			name:  "no client certificate",
+			addr:  newServer(ns, tls.RequestClientCert),
+			creds: credentials.NewTLS(&tls.Config{RootCAs: roots}),
+			code:  codes.Unauthenticated,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := dial(tc.addr, tc.creds)
+			if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != tc.code {
+				t.Fatalf("unary: expected %s, got %v", tc.code, err)
+			}
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != tc.code {
+				t.Fatalf("stream: expected %s, got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+// newTestServerCert returns a self-signed TLS server certificate for 127.0.0.1,
+// and a pool that trusts it.
+func newTestServerCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, roots
+}
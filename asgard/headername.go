@@ -1,9 +1,219 @@
 //go:generate go run golang.org/x/tools/cmd/stringer@latest -linecomment -type=HeaderName
 package asgard
 
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HeaderFormat reads and writes client certificates in request headers,
+// in the format used by a TLS terminating reverse proxy.
+// HeaderName implements HeaderFormat for the built-in formats.
+// Implement it to support other proxies.
+type HeaderFormat interface {
+	// String returns the name of the request header.
+	String() string
+	// Decode returns the client certificate chain in h, leaf first.
+	// It returns an error if the header is missing or does not contain a certificate.
+	Decode(h http.Header) ([]*x509.Certificate, error)
+	// Encode sets the client certificate chain, leaf first, in h.
+	Encode(h http.Header, chain []*x509.Certificate)
+}
+
+// HeaderName is a client certificate header set by a reverse proxy.
 type HeaderName int
 
 const (
+	// AWS ALB mTLS passthrough, URL escaped PEM encoded leaf certificate.
 	HeaderNameClientCertLeaf HeaderName = iota // X-Amzn-Mtls-Clientcert-Leaf
-	HeaderNameClientCert                       // X-Amzn-Mtls-Clientcert
+	// AWS ALB mTLS passthrough, URL escaped PEM encoded certificate chain.
+	HeaderNameClientCert // X-Amzn-Mtls-Clientcert
+	// Envoy x-forwarded-client-cert, with the Cert and Chain elements.
+	HeaderNameEnvoyXFCC // X-Forwarded-Client-Cert
+	// nginx $ssl_client_escaped_cert, URL escaped PEM encoded leaf certificate.
+	HeaderNameNginx // X-Ssl-Client-Cert
+	// Traefik PassTLSClientCert, URL escaped, comma separated, base64 DER encoded chain.
+	HeaderNameTraefik // X-Forwarded-Tls-Client-Cert
+	// Caddy {http.request.tls.client.certificate_der_base64}, base64 DER encoded leaf certificate.
+	HeaderNameCaddy // X-Client-Cert-Der-Base64
+	// Cloudflare forwarded client certificate, base64 DER encoded leaf certificate.
+	HeaderNameCloudflare // Cf-Client-Cert-Der-Base64
 )
+
+var errNoCertHeader = errors.New("no client certificate header")
+
+// Decode returns the client certificate chain in the h header, leaf first.
+func (n HeaderName) Decode(h http.Header) ([]*x509.Certificate, error) {
+	value := h.Get(n.String())
+	if value == "" {
+		return nil, errNoCertHeader
+	}
+
+	switch n {
+	case HeaderNameClientCertLeaf, HeaderNameClientCert, HeaderNameNginx:
+		return decodeEscapedPEM(value)
+	case HeaderNameEnvoyXFCC:
+		return decodeXFCC(value)
+	case HeaderNameTraefik:
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+		return decodeBase64DER(strings.Split(value, ","))
+	case HeaderNameCaddy, HeaderNameCloudflare:
+		return decodeBase64DER([]string{value})
+	}
+	return nil, fmt.Errorf("unsupported header %s", n)
+}
+
+// Encode sets the client certificate chain in the h header.
+// Formats that only carry the leaf certificate ignore the rest of the chain.
+func (n HeaderName) Encode(h http.Header, chain []*x509.Certificate) {
+	if len(chain) == 0 {
+		return
+	}
+
+	var value string
+	switch n {
+	case HeaderNameClientCertLeaf, HeaderNameNginx:
+		value = escapePEM(chain[:1])
+	case HeaderNameClientCert:
+		value = escapePEM(chain)
+	case HeaderNameEnvoyXFCC:
+		value = encodeXFCC(chain)
+	case HeaderNameTraefik:
+		certs := make([]string, len(chain))
+		for i, c := range chain {
+			certs[i] = base64.StdEncoding.EncodeToString(c.Raw)
+		}
+		value = url.QueryEscape(strings.Join(certs, ","))
+	case HeaderNameCaddy, HeaderNameCloudflare:
+		value = base64.StdEncoding.EncodeToString(chain[0].Raw)
+	default:
+		return
+	}
+	h.Set(n.String(), value)
+}
+
+// escapePEM returns URL escaped PEM encoded certificates.
+func escapePEM(certs []*x509.Certificate) string {
+	var buf strings.Builder
+	for _, c := range certs {
+		buf.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	return strings.ReplaceAll(url.QueryEscape(buf.String()), "+", "%20")
+}
+
+func decodeEscapedPEM(value string) ([]*x509.Certificate, error) {
+	certPEM, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodePEM(certPEM)
+}
+
+func decodePEM(certPEM string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode([]byte(certPEM)); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+func decodeBase64DER(values []string) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(values))
+	for _, v := range values {
+		der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// encodeXFCC returns an Envoy x-forwarded-client-cert element for chain.
+func encodeXFCC(chain []*x509.Certificate) string {
+	hash := sha256.Sum256(chain[0].Raw)
+	elem := fmt.Sprintf(`Hash=%s;Cert="%s";Chain="%s"`,
+		hex.EncodeToString(hash[:]), escapePEM(chain[:1]), escapePEM(chain))
+	for _, u := range chain[0].URIs {
+		elem += ";URI=" + u.String()
+	}
+	return elem
+}
+
+// decodeXFCC returns the certificate chain in the first x-forwarded-client-cert element,
+// which the proxy closest to the client adds.
+func decodeXFCC(value string) ([]*x509.Certificate, error) {
+	elem := splitQuoted(value, ',')[0]
+
+	var cert, chain string
+	for _, pair := range splitQuoted(elem, ';') {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid x-forwarded-client-cert field %q", pair)
+		}
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+		}
+		switch strings.ToLower(k) {
+		case "cert":
+			cert = v
+		case "chain":
+			chain = v
+		}
+	}
+
+	// Envoy's Chain includes the leaf certificate.
+	if chain != "" {
+		return decodeEscapedPEM(chain)
+	}
+	if cert != "" {
+		return decodeEscapedPEM(cert)
+	}
+	return nil, errors.New("no Cert or Chain in x-forwarded-client-cert")
+}
+
+// splitQuoted splits s at sep characters that are not inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -10,11 +10,16 @@ func _() {
 	var x [1]struct{}
 	_ = x[HeaderNameClientCertLeaf-0]
 	_ = x[HeaderNameClientCert-1]
+	_ = x[HeaderNameEnvoyXFCC-2]
+	_ = x[HeaderNameNginx-3]
+	_ = x[HeaderNameTraefik-4]
+	_ = x[HeaderNameCaddy-5]
+	_ = x[HeaderNameCloudflare-6]
 }
 
-const _HeaderName_name = "X-Amzn-Mtls-Clientcert-LeafX-Amzn-Mtls-Clientcert"
+const _HeaderName_name = "X-Amzn-Mtls-Clientcert-LeafX-Amzn-Mtls-ClientcertX-Forwarded-Client-CertX-Ssl-Client-CertX-Forwarded-Tls-Client-CertX-Client-Cert-Der-Base64Cf-Client-Cert-Der-Base64"
 
-var _HeaderName_index = [...]uint8{0, 27, 49}
+var _HeaderName_index = [...]uint8{0, 27, 49, 72, 89, 116, 140, 165}
 
 func (i HeaderName) String() string {
 	if i < 0 || i >= HeaderName(len(_HeaderName_index)-1) {
@@ -0,0 +1,177 @@
+package asgard
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/RealImage/bifrost/tinyca"
+	"github.com/google/uuid"
+)
+
+var headerNames = []HeaderName{
+	HeaderNameClientCertLeaf,
+	HeaderNameClientCert,
+	HeaderNameEnvoyXFCC,
+	HeaderNameNginx,
+	HeaderNameTraefik,
+	HeaderNameCaddy,
+	HeaderNameCloudflare,
+}
+
+func TestHeaderName_roundTrip(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+
+	for _, hn := range headerNames {
+		t.Run(hn.String(), func(t *testing.T) {
+			h := http.Header{}
+			hn.Encode(h, chain)
+			if h.Get(hn.String()) == "" {
+				t.Fatalf("expected %s header to be set", hn)
+			}
+
+			got, err := hn.Decode(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := len(chain)
+			switch hn {
+			case HeaderNameClientCertLeaf, HeaderNameNginx, HeaderNameCaddy, HeaderNameCloudflare:
+				want = 1
+			}
+			if len(got) != want {
+				t.Fatalf("expected %d certificates, got %d", want, len(got))
+			}
+			for i, c := range got {
+				if !c.Equal(chain[i]) {
+					t.Fatalf("certificate %d does not match", i)
+				}
+			}
+
+			if _, err := hn.Decode(http.Header{}); err == nil {
+				t.Fatal("expected error for missing header")
+			}
+		})
+	}
+}
+
+func TestHeaderName_Decode_fixtures(t *testing.T) {
+	chain := newTestChain(t, uuid.New())
+	escaped := escapePEM(chain[:1])
+	der := base64.StdEncoding.EncodeToString(chain[0].Raw)
+
+	tests := []struct {
+		name  HeaderName
+		value string
+	}{
+		{
+			// An element from the edge proxy, followed by one from a sidecar.
+			HeaderNameEnvoyXFCC,
+			`By=spiffe://cluster.local/ns/default/sa/backend;Hash=abcd;Cert="` + escaped +
+				`";Subject="CN=a,O=b";URI=spiffe://example.org/x,By=spiffe://cluster.local/ns/x;Hash=ef`,
+		},
+		{
+			// nginx $ssl_client_escaped_cert escapes every reserved character.
+			HeaderNameNginx,
+			strings.NewReplacer("+", "%2B", "/", "%2F", "=", "%3D").Replace(escaped),
+		},
+		{HeaderNameTraefik, url.QueryEscape(der)},
+		{HeaderNameCaddy, der},
+		{HeaderNameCloudflare, der},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name.String(), func(t *testing.T) {
+			h := http.Header{}
+			h.Set(tc.name.String(), tc.value)
+			got, err := tc.name.Decode(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || !got[0].Equal(chain[0]) {
+				t.Fatalf("unexpected certificates %v", got)
+			}
+		})
+	}
+
+	h := http.Header{}
+	h.Set(HeaderNameEnvoyXFCC.String(), `By=spiffe://cluster.local;Hash=abcd`)
+	if _, err := HeaderNameEnvoyXFCC.Decode(h); err == nil {
+		t.Fatal("expected error for x-forwarded-client-cert without a certificate")
+	}
+}
+
+func TestHofund_Heimdallr_headerNames(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+
+	for _, hn := range headerNames {
+		t.Run(hn.String(), func(t *testing.T) {
+			var got *bifrost.Certificate
+			backend := Heimdallr(hn, ns)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got, _ = ClientCert(r.Context())
+			}))
+			proxy := Hofund(hn, ns)(backend)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: chain}
+			req.Header.Set(hn.String(), "forged")
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if got == nil || !got.Certificate.Equal(chain[0]) {
+				t.Fatal("expected client certificate in request context")
+			}
+		})
+	}
+}
+
+// newTestChain returns a client certificate and the CA certificate that issued it.
+func newTestChain(t testing.TB, ns uuid.UUID) []*x509.Certificate {
+	t.Helper()
+	chain, _ := newTestClient(t, ns)
+	return chain
+}
+
+// newTestClient returns a client certificate, the CA certificate that issued it,
+// and the client private key.
+func newTestClient(t testing.TB, ns uuid.UUID) ([]*x509.Certificate, *bifrost.PrivateKey) {
+	t.Helper()
+	caCert, caKey := newTestCA(t, ns)
+	ca, err := tinyca.New(caCert, caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(
+		rand.Reader, bifrost.CertificateRequestTemplate(ns, key.PublicKey()), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := ca.IssueCertificate(csr, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*x509.Certificate{cert, caCert.Certificate}, key
+}
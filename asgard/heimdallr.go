@@ -8,13 +8,15 @@
 // Hofund returns a middleware that parses client certs from the TLS connection.
 // Use Heimdallr if you have a reverse proxy that terminates TLS connections.
 // Use Hofund if you are directly serving TLS connections.
+// Use UnaryServerInterceptor and StreamServerInterceptor in gRPC servers.
+// Use Authenticate with Authenticators combined by FirstOf to accept clients
+// from more than one source in the same handler.
 package asgard
 
 import (
 	"context"
-	"encoding/pem"
 	"net/http"
-	"net/url"
+	"time"
 
 	"github.com/RealImage/bifrost"
 	"github.com/google/uuid"
@@ -22,65 +24,106 @@ import (
 
 const errBadAuthHeader = "missing or invalid authorization information, server is misconfigured"
 
-type keyClientCert struct{}
+type (
+	keyClientCert      struct{}
+	keyClientCertChain struct{}
+)
 
 // ClientCert returns the client certificate from the request context.
 // If the client certificate is not present, the second return value is false.
 // Use this function to access the client certificate in a HTTP handler
-// that has been wrapped with Heimdallr.
+// that has been wrapped with Heimdallr or Hofund, or in a gRPC method handler
+// behind [UnaryServerInterceptor] or [StreamServerInterceptor].
 func ClientCert(ctx context.Context) (*bifrost.Certificate, bool) {
 	cert, ok := ctx.Value(keyClientCert{}).(*bifrost.Certificate)
 	return cert, ok
 }
 
+// ClientCertChain returns the client certificate chain from the request context,
+// starting with the client certificate.
+// If Heimdallr or the gRPC interceptors verified the client certificate with [WithTrustPool],
+// the chain ends with the trusted root.
+// Otherwise it holds the certificates from the header or TLS handshake as sent.
+// If the chain is not present, the second return value is false.
+func ClientCertChain(ctx context.Context) ([]*bifrost.Certificate, bool) {
+	chain, ok := ctx.Value(keyClientCertChain{}).([]*bifrost.Certificate)
+	return chain, ok
+}
+
+// withClientCerts returns a copy of ctx holding the client certificate certs[0]
+// and its chain.
+func withClientCerts(ctx context.Context, certs []*bifrost.Certificate) context.Context {
+	ctx = context.WithValue(ctx, keyClientCert{}, certs[0])
+	return context.WithValue(ctx, keyClientCertChain{}, certs)
+}
+
 // Heimdallr returns a middleware that parses a client certificate from the
-// h request header.
+// request header in format h.
+// Use a [HeaderName] for the formats of AWS ALB, Envoy, nginx, Traefik, Caddy,
+// and Cloudflare, or implement [HeaderFormat] for other proxies.
 //
 // If a certificate is not found or is invalid, the middleware responds
 // with a 503 Service Unavailable.
 // If the certificate namespace does not match ns, the middleware
 // responds with a 403 Forbidden.
 //
+// Headers that carry a certificate chain, such as [HeaderNameClientCert], can include
+// intermediate CA certificates, and every certificate in the header must be a bifrost certificate.
+// Use [ClientCert] and [ClientCertChain] to get the client certificate and its chain.
+//
+// Without [WithTrustPool], Heimdallr trusts any bifrost certificate in the header.
+// With it, the certificate must chain up to a CA in the trust pool through the
+// intermediates in the header.
+// Certificates that are expired, not yet valid, not signed by a trusted CA,
+// or not usable for client authentication are rejected with a 401 Unauthorized,
+// and counted in the bifrost_heimdallr_rejected_total metric by reason.
+//
+// Use [WithTrustedProxies], [WithProxyHMAC], or [WithProxyPublicKey] to only trust
+// the header in requests from the proxy. Other requests get a 401 Unauthorized.
+//
 // Use this if you have a reverse proxy that terminates TLS connections and
 // passes the client certificate in a request header.
-func Heimdallr(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
+func Heimdallr(h HeaderFormat, ns uuid.UUID, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	m := newHeimdallrMetrics(ns)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 
-			certHeader := r.Header.Get(h.String())
-			if certHeader == "" {
-				bifrost.Logger().ErrorContext(ctx, "missing authorization header")
-				http.Error(w, errBadAuthHeader, http.StatusServiceUnavailable)
-				return
+			if o.enforcesProxyTrust() {
+				if err := o.checkProxy(r, h, time.Now()); err != nil {
+					bifrost.Logger().ErrorContext(
+						ctx, "client certificate header from untrusted proxy",
+						"remoteAddr", r.RemoteAddr,
+						"error", err,
+					)
+					m.rejected(reasonUntrustedProxy).Inc()
+					http.Error(w, "untrusted proxy", http.StatusUnauthorized)
+					return
+				}
 			}
 
-			certPEM, err := url.PathUnescape(certHeader)
+			certs, err := o.headerCerts(h, r.Header)
 			if err != nil {
 				bifrost.Logger().ErrorContext(
-					ctx, "error decoding header",
+					ctx, "error parsing client certificate header",
 					"headerName", h.String(),
-					"headerValue", certHeader,
+					"error", err,
 				)
 				http.Error(w, errBadAuthHeader, http.StatusServiceUnavailable)
 				return
 			}
+			cert := certs[0]
 
-			block, _ := pem.Decode([]byte(certPEM))
-			if block == nil {
+			if certs, err = o.verifyCerts(certs, time.Now()); err != nil {
+				reason := rejectReason(err)
 				bifrost.Logger().ErrorContext(
-					ctx, "no PEM data found in authorization header",
-					"headerName", h.String(),
-					"headerValue", certPEM,
+					ctx, "client certificate rejected",
+					"reason", reason,
+					"error", err,
 				)
-				http.Error(w, errBadAuthHeader, http.StatusServiceUnavailable)
-				return
-			}
-
-			cert, err := bifrost.ParseCertificate(block.Bytes)
-			if err != nil {
-				bifrost.Logger().ErrorContext(ctx, "error parsing client certificate", "error", err)
-				http.Error(w, errBadAuthHeader, http.StatusServiceUnavailable)
+				m.rejected(reason).Inc()
+				http.Error(w, "invalid client certificate", http.StatusUnauthorized)
 				return
 			}
 
@@ -90,13 +133,13 @@ func Heimdallr(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
 					"expected", ns,
 					"actual", cert.Namespace,
 				)
+				m.rejected(reasonNamespace).Inc()
 				http.Error(w, "incorrect namespace", http.StatusForbidden)
 				return
 			}
+			m.accepted.Inc()
 
-			ctx = context.WithValue(ctx, keyClientCert{}, cert)
-			r = r.WithContext(ctx)
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(withClientCerts(ctx, certs)))
 		})
 	}
 }
@@ -3,21 +3,23 @@ package asgard
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/RealImage/bifrost"
+	"github.com/RealImage/bifrost/tinyca"
 	"github.com/google/uuid"
 )
 
-var testPubKey = &bifrost.PublicKey{
-	PublicKey: &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-	},
-}
+var testPubKey = &bifrost.PublicKey{}
 
 func init() {
 	x := big.NewInt(0)
@@ -29,8 +31,11 @@ func init() {
 	)
 	y.SetString("35068856771725771339387917164601956621562646129885199575367583771781073078262", 10)
 
-	testPubKey.X = x
-	testPubKey.Y = y
+	testPubKey.PublicKey = &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     x,
+		Y:     y,
+	}
 }
 
 var heimdallrTestCases = []struct {
@@ -90,3 +95,196 @@ func TestHeimdallr(t *testing.T) {
 		})
 	}
 }
+
+func TestHeimdallr_trustPool(t *testing.T) {
+	ns := uuid.New()
+	caCert, caKey := newTestCA(t, ns)
+	otherCert, otherKey := newTestCA(t, ns)
+	now := time.Now()
+
+	serverAuth := func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	tests := []struct {
+		name      string
+		cert      *bifrost.Certificate
+		key       *bifrost.PrivateKey
+		notBefore time.Time
+		notAfter  time.Time
+		modify    func(*x509.Certificate)
+		code      int
+		reason    string
+	}{
+		{"valid", caCert, caKey, now.Add(-time.Minute), now.Add(time.Hour), nil, http.StatusOK, ""},
+		{
+			"expired", caCert, caKey, now.Add(-2 * time.Hour), now.Add(-time.Hour), nil,
+			http.StatusUnauthorized, reasonExpired,
+		},
+		{
+			"not yet valid", caCert, caKey, now.Add(time.Hour), now.Add(2 * time.Hour), nil,
+			http.StatusUnauthorized, reasonNotYetValid,
+		},
+		{
+			"untrusted", otherCert, otherKey, now.Add(-time.Minute), now.Add(time.Hour), nil,
+			http.StatusUnauthorized, reasonUntrusted,
+		},
+		{
+			"server auth", caCert, caKey, now.Add(-time.Minute), now.Add(time.Hour), serverAuth,
+			http.StatusUnauthorized, reasonInvalid,
+		},
+	}
+
+	hm := Heimdallr(HeaderNameClientCertLeaf, ns, WithTrustPool(caCert))
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clientKey, err := bifrost.NewPrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			template := tinyca.TLSClientCertTemplate()
+			template.SerialNumber = big.NewInt(now.UnixNano())
+			template.Subject.Organization = []string{ns.String()}
+			template.Subject.CommonName = clientKey.UUID(ns).String()
+			template.NotBefore = tc.notBefore
+			template.NotAfter = tc.notAfter
+			if tc.modify != nil {
+				tc.modify(template)
+			}
+			der, err := x509.CreateCertificate(
+				rand.Reader, template, tc.cert.Certificate, clientKey.Public(), tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rejected uint64
+			if tc.reason != "" {
+				rejected = newHeimdallrMetrics(ns).rejected(tc.reason).Get()
+			}
+
+			certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(HeaderNameClientCertLeaf.String(), url.PathEscape(string(certPem)))
+			w := httptest.NewRecorder()
+			hm(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, req)
+
+			if w.Code != tc.code {
+				t.Fatalf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if tc.reason != "" {
+				if got := newHeimdallrMetrics(ns).rejected(tc.reason).Get(); got != rejected+1 {
+					t.Fatalf("expected %s rejections to be %v, got %v", tc.reason, rejected+1, got)
+				}
+			}
+		})
+	}
+}
+
+func newTestCA(t testing.TB, ns uuid.UUID) (*bifrost.Certificate, *bifrost.PrivateKey) {
+	t.Helper()
+	key, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := tinyca.CACertTemplate(ns, key.UUID(ns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-24 * time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := bifrost.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestHeimdallr_chain(t *testing.T) {
+	ns := uuid.New()
+	rootCert, rootKey := newTestCA(t, ns)
+	root, err := tinyca.New(rootCert, rootKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Stop()
+
+	intKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intDer, err := root.IssueIntermediateCertificate(
+		intKey.PublicKey(), time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intCert, err := bifrost.ParseCertificate(intDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := tinyca.New(intCert, intKey, nil, tinyca.WithChain(rootCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	clientKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(
+		rand.Reader, bifrost.CertificateRequestTemplate(ns, clientKey.PublicKey()), clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDer, err := ca.IssueCertificate(csr, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		code  int
+	}{
+		{"full chain", []*x509.Certificate{leaf, intCert.Certificate}, http.StatusOK},
+		{"leaf only", []*x509.Certificate{leaf}, http.StatusUnauthorized},
+	}
+
+	hm := Heimdallr(HeaderNameClientCert, ns, WithTrustPool(rootCert))
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var chain []*bifrost.Certificate
+			handler := hm(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				cert, ok := ClientCert(r.Context())
+				if !ok || !cert.Certificate.Equal(leaf) {
+					t.Error("expected client certificate in request context")
+				}
+				chain, _ = ClientCertChain(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			HeaderNameClientCert.Encode(req.Header, tc.chain)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.code {
+				t.Fatalf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if tc.code != http.StatusOK {
+				return
+			}
+			if len(chain) != 3 ||
+				!chain[1].Equal(intCert.Certificate) ||
+				!chain[2].Equal(rootCert.Certificate) {
+				t.Fatalf("expected verified chain to root, got %d certificates", len(chain))
+			}
+		})
+	}
+}
@@ -1,24 +1,31 @@
 package asgard
 
 import (
-	"encoding/pem"
 	"net/http"
-	"net/url"
+	"time"
 
 	"github.com/RealImage/bifrost"
 	"github.com/google/uuid"
 )
 
 // Hofund returns a middleware that validates a client certificate
-// and sets the certificate in the h request header.
+// and sets the certificate chain in the request header in format h,
+// replacing any value sent by the client.
 //
 // If a certificate is not found or is invalid, the middleware responds
 // with a 401 Unauthorized.
 // If the certificate namespace does not match ns, the middleware
 // responds with a 403 Forbidden.
 //
+// The client certificate and its chain are also available from [ClientCert] and
+// [ClientCertChain] in the request context.
+//
+// With [WithProxyHMAC] or [WithProxySigner], Hofund also signs the header in
+// [HeaderNameProxySignature], so that Heimdallr can check it came from the proxy.
+//
 // Use this if you are directly serving TLS connections.
-func Hofund(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
+func Hofund(h HeaderFormat, ns uuid.UUID, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
@@ -26,7 +33,7 @@ func Hofund(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
 			}
 			ctx := r.Context()
 
-			cert, err := bifrost.NewCertificate(r.TLS.PeerCertificates[0])
+			certs, err := o.peerCerts(r.TLS.PeerCertificates)
 			if err != nil {
 				bifrost.Logger().
 					ErrorContext(ctx, "error validating client certificate", "error", err)
@@ -34,6 +41,7 @@ func Hofund(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
 				return
 			}
 
+			cert := certs[0]
 			if cert.Namespace != ns {
 				bifrost.Logger().ErrorContext(
 					ctx, "client certificate namespace mismatch",
@@ -44,15 +52,16 @@ func Hofund(h HeaderName, ns uuid.UUID) func(http.Handler) http.Handler {
 				return
 			}
 
-			certPEM := pem.EncodeToMemory(&pem.Block{
-				Type:  "CERTIFICATE",
-				Bytes: cert.Raw,
-			})
-			hval := url.QueryEscape(string(certPEM))
-
-			r.Header.Set(h.String(), hval)
+			r.Header.Del(h.String())
+			h.Encode(r.Header, r.TLS.PeerCertificates)
+			if err := o.signProxy(r, h, time.Now()); err != nil {
+				bifrost.Logger().
+					ErrorContext(ctx, "error signing client certificate header", "error", err)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(withClientCerts(ctx, certs)))
 		})
 	}
 }
@@ -1,6 +1,7 @@
 package asgard
 
 import (
+	"crypto/ecdsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -64,7 +65,7 @@ func TestHofund(t *testing.T) {
 	}
 	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
 
-	privBytes, err := x509.MarshalECPrivateKey(priv.PrivateKey)
+	privBytes, err := x509.MarshalECPrivateKey(priv.PrivateKey.(*ecdsa.PrivateKey))
 	if err != nil {
 		t.Errorf("error marshaling private key %s", err)
 	}
@@ -150,3 +151,31 @@ func TestHofund(t *testing.T) {
 	}
 	defer resp.Body.Close()
 }
+
+func TestHofund_clientCertChain(t *testing.T) {
+	ns := uuid.New()
+	chain, _ := newTestClient(t, ns)
+
+	var got []*bifrost.Certificate
+	hf := Hofund(HeaderNameClientCert, ns)(
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			got, _ = ClientCertChain(r.Context())
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: chain}
+	w := httptest.NewRecorder()
+	hf.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(got) != len(chain) {
+		t.Fatalf("expected a chain of %d certificates, got %d", len(chain), len(got))
+	}
+	for i, c := range got {
+		if !c.Equal(chain[i]) {
+			t.Fatalf("certificate %d does not match the peer chain", i)
+		}
+	}
+}
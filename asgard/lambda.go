@@ -0,0 +1,216 @@
+package asgard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// APIGatewayProxyHandler handles API Gateway REST API proxy events in AWS Lambda.
+type APIGatewayProxyHandler func(
+	context.Context,
+	events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error)
+
+// APIGatewayV2HTTPHandler handles API Gateway HTTP API (payload version 2.0) events in AWS Lambda.
+type APIGatewayV2HTTPHandler func(
+	context.Context,
+	events.APIGatewayV2HTTPRequest,
+) (events.APIGatewayV2HTTPResponse, error)
+
+// FunctionURLHandler handles Lambda Function URL events.
+type FunctionURLHandler func(
+	context.Context,
+	events.LambdaFunctionURLRequest,
+) (events.LambdaFunctionURLResponse, error)
+
+var errNoEventClientCert = errors.New("no client certificate in event, is mutual TLS enabled?")
+
+// APIGatewayProxy returns a middleware for Lambda handlers of API Gateway REST API events,
+// that validates the client certificate from API Gateway mutual TLS authentication
+// in requestContext.identity.clientCert.
+//
+// The certificate is validated like [Heimdallr] does, with the same options and responses,
+// and is available from [ClientCert] in the handler context.
+func APIGatewayProxy(ns uuid.UUID, opts ...Option) func(APIGatewayProxyHandler) APIGatewayProxyHandler {
+	o := newOptions(opts)
+	m := newHeimdallrMetrics(ns)
+	return func(next APIGatewayProxyHandler) APIGatewayProxyHandler {
+		return func(
+			ctx context.Context,
+			event events.APIGatewayProxyRequest,
+		) (events.APIGatewayProxyResponse, error) {
+			var certPEM string
+			if cc := event.RequestContext.Identity.ClientCert; cc != nil {
+				certPEM = cc.ClientCertPem
+			}
+			ctx, code, msg := o.authenticateEvent(ctx, ns, m, func() ([]*bifrost.Certificate, error) {
+				return o.pemCerts(certPEM)
+			})
+			if code != 0 {
+				return events.APIGatewayProxyResponse{
+					StatusCode: code,
+					Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+					Body:       msg,
+				}, nil
+			}
+			return next(ctx, event)
+		}
+	}
+}
+
+// APIGatewayV2HTTP returns a middleware for Lambda handlers of API Gateway HTTP API events,
+// that validates the client certificate from API Gateway mutual TLS authentication
+// in requestContext.authentication.clientCert.
+// See [APIGatewayProxy].
+func APIGatewayV2HTTP(
+	ns uuid.UUID,
+	opts ...Option,
+) func(APIGatewayV2HTTPHandler) APIGatewayV2HTTPHandler {
+	o := newOptions(opts)
+	m := newHeimdallrMetrics(ns)
+	return func(next APIGatewayV2HTTPHandler) APIGatewayV2HTTPHandler {
+		return func(
+			ctx context.Context,
+			event events.APIGatewayV2HTTPRequest,
+		) (events.APIGatewayV2HTTPResponse, error) {
+			certPEM := event.RequestContext.Authentication.ClientCert.ClientCertPem
+			ctx, code, msg := o.authenticateEvent(ctx, ns, m, func() ([]*bifrost.Certificate, error) {
+				return o.pemCerts(certPEM)
+			})
+			if code != 0 {
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: code,
+					Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+					Body:       msg,
+				}, nil
+			}
+			return next(ctx, event)
+		}
+	}
+}
+
+// FunctionURL returns a middleware for Lambda Function URL handlers.
+// Function URLs do not support mutual TLS, so the client certificate is read from the
+// request header in format h, set by a TLS terminating proxy in front of the function.
+//
+// The certificate is validated like [Heimdallr] does, with the same options and responses,
+// including the trusted proxy options, which see the event source IP as the remote address.
+// It is available from [ClientCert] in the handler context.
+func FunctionURL(h HeaderFormat, ns uuid.UUID, opts ...Option) func(FunctionURLHandler) FunctionURLHandler {
+	o := newOptions(opts)
+	m := newHeimdallrMetrics(ns)
+	return func(next FunctionURLHandler) FunctionURLHandler {
+		return func(
+			ctx context.Context,
+			event events.LambdaFunctionURLRequest,
+		) (events.LambdaFunctionURLResponse, error) {
+			// RawPath is escaped as sent by the client, and proxy signatures cover it as is.
+			u := &url.URL{RawPath: event.RawPath, RawQuery: event.RawQueryString}
+			code, msg := 0, ""
+			var err error
+			if u.Path, err = url.PathUnescape(event.RawPath); err != nil {
+				code, msg = http.StatusBadRequest, "invalid request path"
+			}
+			r := &http.Request{
+				Method:     event.RequestContext.HTTP.Method,
+				Host:       event.RequestContext.DomainName,
+				URL:        u,
+				Header:     make(http.Header, len(event.Headers)),
+				RemoteAddr: net.JoinHostPort(event.RequestContext.HTTP.SourceIP, "0"),
+			}
+			for k, v := range event.Headers {
+				r.Header.Set(k, v)
+			}
+
+			if code == 0 && o.enforcesProxyTrust() {
+				if err := o.checkProxy(r, h, time.Now()); err != nil {
+					bifrost.Logger().ErrorContext(
+						ctx, "client certificate header from untrusted proxy",
+						"remoteAddr", r.RemoteAddr,
+						"error", err,
+					)
+					m.rejected(reasonUntrustedProxy).Inc()
+					code, msg = http.StatusUnauthorized, "untrusted proxy"
+				}
+			}
+			if code == 0 {
+				ctx, code, msg = o.authenticateEvent(ctx, ns, m, func() ([]*bifrost.Certificate, error) {
+					return o.headerCerts(h, r.Header)
+				})
+			}
+			if code != 0 {
+				return events.LambdaFunctionURLResponse{
+					StatusCode: code,
+					Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+					Body:       msg,
+				}, nil
+			}
+			return next(ctx, event)
+		}
+	}
+}
+
+// pemCerts parses the PEM encoded client certificate chain from an event.
+func (o *options) pemCerts(certPEM string) ([]*bifrost.Certificate, error) {
+	if certPEM == "" {
+		return nil, errNoEventClientCert
+	}
+	return o.cachedCerts(
+		func() cacheKey { return stringsCacheKey("pem", certPEM) },
+		func() ([]*bifrost.Certificate, error) {
+			chain, err := decodePEM(certPEM)
+			if err != nil {
+				return nil, err
+			}
+			return o.parseCerts(chain)
+		},
+	)
+}
+
+// authenticateEvent validates the client certificate chain returned by certs like Heimdallr,
+// and returns a context holding it.
+// If the client is rejected, it returns a non-zero status code and response body.
+func (o *options) authenticateEvent(
+	ctx context.Context,
+	ns uuid.UUID,
+	m *heimdallrMetrics,
+	certs func() ([]*bifrost.Certificate, error),
+) (context.Context, int, string) {
+	chain, err := certs()
+	if err != nil {
+		bifrost.Logger().ErrorContext(ctx, "error parsing client certificate", "error", err)
+		return ctx, http.StatusServiceUnavailable, errBadAuthHeader
+	}
+
+	if chain, err = o.verifyCerts(chain, time.Now()); err != nil {
+		reason := rejectReason(err)
+		bifrost.Logger().ErrorContext(
+			ctx, "client certificate rejected",
+			"reason", reason,
+			"error", err,
+		)
+		m.rejected(reason).Inc()
+		return ctx, http.StatusUnauthorized, "invalid client certificate"
+	}
+
+	if cert := chain[0]; cert.Namespace != ns {
+		bifrost.Logger().ErrorContext(
+			ctx, "client certificate namespace mismatch",
+			"expected", ns,
+			"actual", cert.Namespace,
+		)
+		m.rejected(reasonNamespace).Inc()
+		return ctx, http.StatusForbidden, "incorrect namespace"
+	}
+	m.accepted.Inc()
+
+	return withClientCerts(ctx, chain), 0, ""
+}
@@ -0,0 +1,221 @@
+package asgard
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// loadEvent unmarshals the event fixture name into v, after replacing
+// {{key}} placeholders with values from vars.
+func loadEvent(t *testing.T, name string, vars map[string]string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	for k, val := range vars {
+		enc, err := json.Marshal(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = strings.ReplaceAll(s, `"{{`+k+`}}"`, string(enc))
+	}
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func encodePEM(chain []*x509.Certificate) string {
+	var b strings.Builder
+	for _, c := range chain {
+		b.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	return b.String()
+}
+
+// clientIDBody returns the client identity from ctx, to use as a response body.
+func clientIDBody(ctx context.Context) string {
+	if cert, ok := ClientCert(ctx); ok {
+		return cert.ID.String()
+	}
+	return ""
+}
+
+func TestAPIGatewayProxy(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+	caCert := toBifrost(t, chain)[1]
+	otherCA, _ := newTestCA(t, ns)
+
+	next := func(ctx context.Context, _ events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: clientIDBody(ctx)}, nil
+	}
+
+	tests := []struct {
+		name    string
+		certPEM string
+		ns      uuid.UUID
+		opts    []Option
+		code    int
+	}{
+		{"valid", encodePEM(chain[:1]), ns, nil, http.StatusOK},
+		{"trusted", encodePEM(chain[:1]), ns, []Option{WithTrustPool(caCert)}, http.StatusOK},
+		{"untrusted", encodePEM(chain[:1]), ns, []Option{WithTrustPool(otherCA)}, http.StatusUnauthorized},
+		{"wrong namespace", encodePEM(chain[:1]), uuid.New(), nil, http.StatusForbidden},
+		{"no certificate", "", ns, nil, http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event events.APIGatewayProxyRequest
+			loadEvent(t, "apigw-rest-mtls.json", map[string]string{"clientCertPem": tc.certPEM}, &event)
+
+			resp, err := APIGatewayProxy(tc.ns, tc.opts...)(next)(context.Background(), event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("expected status %d, got %d: %s", tc.code, resp.StatusCode, resp.Body)
+			}
+			if tc.code == http.StatusOK && resp.Body != key.UUID(ns).String() {
+				t.Fatalf("expected client %s, got %q", key.UUID(ns), resp.Body)
+			}
+		})
+	}
+}
+
+func TestAPIGatewayV2HTTP(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+
+	next := func(ctx context.Context, _ events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Body: clientIDBody(ctx)}, nil
+	}
+
+	for certPEM, code := range map[string]int{
+		encodePEM(chain[:1]): http.StatusOK,
+		"":                   http.StatusServiceUnavailable,
+		"not a certificate":  http.StatusServiceUnavailable,
+	} {
+		var event events.APIGatewayV2HTTPRequest
+		loadEvent(t, "apigw-http-mtls.json", map[string]string{"clientCertPem": certPEM}, &event)
+
+		resp, err := APIGatewayV2HTTP(ns, WithCertCache(10))(next)(context.Background(), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != code {
+			t.Fatalf("expected status %d, got %d: %s", code, resp.StatusCode, resp.Body)
+		}
+		if code == http.StatusOK && resp.Body != key.UUID(ns).String() {
+			t.Fatalf("expected client %s, got %q", key.UUID(ns), resp.Body)
+		}
+	}
+}
+
+func TestFunctionURL(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+	hdr := make(http.Header)
+	HeaderNameClientCert.Encode(hdr, chain)
+
+	next := func(ctx context.Context, _ events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+		return events.LambdaFunctionURLResponse{StatusCode: http.StatusOK, Body: clientIDBody(ctx)}, nil
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		code int
+	}{
+		{"valid", nil, http.StatusOK},
+		{"trusted proxy", []Option{WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8"))},
+			http.StatusOK},
+		{"untrusted proxy", []Option{WithTrustedProxies(netip.MustParsePrefix("192.168.0.0/16"))},
+			http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event events.LambdaFunctionURLRequest
+			loadEvent(t, "lambda-url-header.json",
+				map[string]string{"clientCertHeader": hdr.Get(HeaderNameClientCert.String())}, &event)
+
+			resp, err := FunctionURL(HeaderNameClientCert, ns, tc.opts...)(next)(context.Background(), event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("expected status %d, got %d: %s", tc.code, resp.StatusCode, resp.Body)
+			}
+			if tc.code == http.StatusOK && resp.Body != key.UUID(ns).String() {
+				t.Fatalf("expected client %s, got %q", key.UUID(ns), resp.Body)
+			}
+		})
+	}
+}
+
+func TestFunctionURL_proxySignature(t *testing.T) {
+	ns := uuid.New()
+	chain, key := newTestClient(t, ns)
+	hmacKey := []byte("correct horse battery staple")
+
+	// Sign the header as Hofund does for the request the proxy forwards.
+	req := httptest.NewRequest(http.MethodGet,
+		"https://abcdefghijklmnopqrstuvwxyz012345.lambda-url.us-east-1.on.aws"+
+			"/orders/caf%C3%A9%2Fmenu?q=hot%20drinks", nil)
+	HeaderNameClientCert.Encode(req.Header, chain)
+	o := newOptions([]Option{WithProxyHMAC(hmacKey)})
+	if err := o.signProxy(req, HeaderNameClientCert, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	next := func(ctx context.Context, _ events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+		return events.LambdaFunctionURLResponse{StatusCode: http.StatusOK, Body: clientIDBody(ctx)}, nil
+	}
+	tests := []struct {
+		name    string
+		rawPath string
+		code    int
+	}{
+		{"escaped path", "", http.StatusOK},
+		{"other path", "/orders/caf%C3%A9", http.StatusUnauthorized},
+		{"invalid path", "/orders/%zz", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event events.LambdaFunctionURLRequest
+			loadEvent(t, "lambda-url-signed.json", map[string]string{
+				"clientCertHeader": req.Header.Get(HeaderNameClientCert.String()),
+				"proxySignature":   req.Header.Get(HeaderNameProxySignature),
+			}, &event)
+			if tc.rawPath != "" {
+				event.RawPath = tc.rawPath
+			}
+
+			resp, err := FunctionURL(HeaderNameClientCert, ns, WithProxyHMAC(hmacKey))(next)(
+				context.Background(), event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("expected status %d, got %d: %s", tc.code, resp.StatusCode, resp.Body)
+			}
+			if tc.code == http.StatusOK && resp.Body != key.UUID(ns).String() {
+				t.Fatalf("expected client %s, got %q", key.UUID(ns), resp.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package asgard
+
+import (
+	"crypto"
+	"net/netip"
+
+	"github.com/RealImage/bifrost"
+)
+
+// Option configures optional behaviour of the asgard middleware.
+type Option func(*options)
+
+type options struct {
+	parseOpts []bifrost.ParseOption
+	trustPool []*bifrost.Certificate
+
+	// trusted proxy enforcement
+	trustedProxies []netip.Prefix
+	proxyHMACKey   []byte
+	proxySigner    crypto.Signer
+	proxyPublicKey *bifrost.PublicKey
+
+	errorHandler ErrorHandler
+	certCache    *certCache
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLegacyRSA returns an Option that accepts client certificates issued to
+// legacy RSA keys.
+// Use this together with a CA created with the tinyca.WithLegacyRSA option.
+func WithLegacyRSA() Option {
+	return func(o *options) {
+		o.parseOpts = append(o.parseOpts, bifrost.AllowLegacyRSA())
+	}
+}
+
+// WithTrustDomains returns an Option that checks SPIFFE IDs in client certificates
+// against the trust domain to namespace mapping td.
+// See [bifrost.WithTrustDomains].
+func WithTrustDomains(td bifrost.TrustDomains) Option {
+	return func(o *options) {
+		o.parseOpts = append(o.parseOpts, bifrost.WithTrustDomains(td))
+	}
+}
+
+// WithTrustPool returns an Option that makes Heimdallr verify client certificates
+// against roots, which can be loaded with cafiles.GetTrustPool.
+// Certificates must be signed by a CA in roots, be valid at the time of the request,
+// and be usable for client authentication.
+// roots may include intermediate CA certificates, which are then trusted directly.
+func WithTrustPool(roots ...*bifrost.Certificate) Option {
+	return func(o *options) {
+		o.trustPool = append(o.trustPool, roots...)
+	}
+}
@@ -0,0 +1,343 @@
+package asgard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Effect is the outcome of an authorization rule.
+type Effect string
+
+// Authorization effects.
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Policy is a list of authorization rules for HTTP routes.
+// Rules are evaluated in order, and the first rule that matches a request decides it.
+// Requests that match no rule get the Default effect, which is deny unless set to allow.
+//
+// Policies are written in YAML or JSON:
+//
+//	default: deny
+//	rules:
+//	  - name: admins
+//	    ous: [admin]
+//	    paths: ["/admin/**"]
+//	  - name: read-only
+//	    namespaces: [80485314-6c73-40ff-86c5-a5942a0f514f]
+//	    methods: [GET, HEAD]
+//	    paths: ["/**"]
+type Policy struct {
+	Default Effect `json:"default,omitempty" yaml:"default,omitempty"`
+	Rules   []Rule `json:"rules"             yaml:"rules"`
+}
+
+// Rule matches requests from client certificates to HTTP routes.
+// Empty fields match everything, a field matches if any of its values match,
+// and a rule matches if all of its fields match.
+type Rule struct {
+	// Name identifies the rule in decision logs.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Effect is the decision for matching requests, allow unless set to deny.
+	Effect Effect `json:"effect,omitempty" yaml:"effect,omitempty"`
+
+	// IDs are client identity UUIDs.
+	IDs []uuid.UUID `json:"ids,omitempty" yaml:"ids,omitempty"`
+	// Namespaces are client identity namespaces.
+	Namespaces []uuid.UUID `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// OUs are organizational units in the certificate subject.
+	OUs []string `json:"ous,omitempty" yaml:"ous,omitempty"`
+	// SANs are patterns, in [path.Match] syntax, of URI, DNS, or email subject alternative names.
+	SANs []string `json:"sans,omitempty" yaml:"sans,omitempty"`
+
+	// Methods are HTTP methods.
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Paths are URL path patterns in [path.Match] syntax.
+	// Patterns ending in /** also match every path below the prefix.
+	Paths []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+// Decision is the result of evaluating a policy for a request.
+type Decision struct {
+	Allow bool
+	// Rule is the name of the rule that decided the request,
+	// or empty if the policy default decided it.
+	Rule string
+}
+
+// ParsePolicy parses and validates a YAML or JSON policy.
+// Unknown fields are errors, so that a misspelled field does not leave a rule matching everything.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := decodeYAML(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// decodeYAML decodes YAML or JSON data into v, rejecting fields v does not have.
+// Empty data leaves v unchanged.
+func decodeYAML(data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func (p *Policy) validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("policy default: %w", err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		if err := rule.Effect.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		for j, m := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(m)
+		}
+		for _, pattern := range append(slices.Clone(rule.SANs), rule.Paths...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid pattern %q: %w", rule.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e Effect) validate() error {
+	switch e {
+	case "", EffectAllow, EffectDeny:
+		return nil
+	}
+	return fmt.Errorf("invalid effect %q", e)
+}
+
+// Policy returns p, so that a Policy can be used as a static [PolicySource].
+func (p *Policy) Policy() *Policy {
+	return p
+}
+
+// Decide evaluates the policy for a request r from the client with certificate cert.
+// Paths are matched in their canonical form, so that dot segments and repeated slashes
+// cannot get around a rule.
+func (p *Policy) Decide(cert *bifrost.Certificate, r *http.Request) Decision {
+	urlPath := cleanPath(r.URL.Path)
+	for _, rule := range p.Rules {
+		if rule.matches(cert, r.Method, urlPath) {
+			return Decision{Allow: rule.Effect != EffectDeny, Rule: rule.Name}
+		}
+	}
+	return Decision{Allow: p.Default == EffectAllow}
+}
+
+func (rule *Rule) matches(cert *bifrost.Certificate, method, urlPath string) bool {
+	if len(rule.IDs) != 0 && !slices.Contains(rule.IDs, cert.ID) {
+		return false
+	}
+	if len(rule.Namespaces) != 0 && !slices.Contains(rule.Namespaces, cert.Namespace) {
+		return false
+	}
+	if len(rule.OUs) != 0 && !slices.ContainsFunc(cert.Subject.OrganizationalUnit, func(ou string) bool {
+		return slices.Contains(rule.OUs, ou)
+	}) {
+		return false
+	}
+	if len(rule.SANs) != 0 && !slices.ContainsFunc(certSANs(cert), func(san string) bool {
+		return slices.ContainsFunc(rule.SANs, func(pattern string) bool {
+			ok, _ := path.Match(pattern, san)
+			return ok
+		})
+	}) {
+		return false
+	}
+	if len(rule.Methods) != 0 && !slices.Contains(rule.Methods, method) {
+		return false
+	}
+	if len(rule.Paths) != 0 && !slices.ContainsFunc(rule.Paths, func(pattern string) bool {
+		return matchPath(pattern, urlPath)
+	}) {
+		return false
+	}
+	return true
+}
+
+func certSANs(cert *bifrost.Certificate) []string {
+	sans := slices.Concat(cert.DNSNames, cert.EmailAddresses)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// cleanPath returns the canonical form of the URL path p,
+// resolving dot segments and repeated slashes, and keeping a trailing slash.
+func cleanPath(p string) string {
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+func matchPath(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// PolicySource provides the current authorization policy.
+type PolicySource interface {
+	Policy() *Policy
+}
+
+// PolicyFile is a [PolicySource] that reloads its policy when the file changes.
+type PolicyFile struct {
+	path    string
+	policy  atomic.Pointer[Policy]
+	modTime time.Time
+	size    int64
+}
+
+// LoadPolicyFile loads the policy file at name.
+// If interval is positive, the file is checked for changes every interval until ctx is done.
+// A changed file that fails to parse is logged, and the previous policy stays in effect.
+func LoadPolicyFile(ctx context.Context, name string, interval time.Duration) (*PolicyFile, error) {
+	f := &PolicyFile{path: name}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := f.reload(); err != nil {
+						bifrost.Logger().ErrorContext(ctx, "error reloading authorization policy",
+							"path", name, "error", err)
+					}
+				}
+			}
+		}()
+	}
+	return f, nil
+}
+
+// Policy returns the last policy loaded from the file.
+func (f *PolicyFile) Policy() *Policy {
+	return f.policy.Load()
+}
+
+func (f *PolicyFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.policy.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+
+	if f.policy.Swap(p) != nil {
+		bifrost.Logger().Info("reloaded authorization policy", "path", f.path, "rules", len(p.Rules))
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Authorize returns a middleware that authorizes requests with the policy from src.
+// It must run after Heimdallr or Hofund, which put the client certificate in the request context.
+//
+// Requests without a client certificate get a 401 Unauthorized,
+// requests for non-canonical paths, with dot segments or repeated slashes, get a 400 Bad Request,
+// and requests the policy denies get a 403 Forbidden.
+// Rejecting non-canonical paths keeps upstream servers that resolve paths differently
+// from reaching a route the policy denies.
+// Every decision is logged, and counted in the bifrost_authz_decisions_total metric.
+func Authorize(src PolicySource) func(http.Handler) http.Handler {
+	allowed := bifrost.StatsForNerds.GetOrCreateCounter(`bifrost_authz_decisions_total{decision="allow"}`)
+	denied := bifrost.StatsForNerds.GetOrCreateCounter(`bifrost_authz_decisions_total{decision="deny"}`)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			cert, ok := ClientCert(ctx)
+			if !ok {
+				bifrost.Logger().ErrorContext(ctx, "no client certificate to authorize")
+				denied.Inc()
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if r.URL.Path != cleanPath(r.URL.Path) {
+				bifrost.Logger().ErrorContext(ctx, "non-canonical request path", "path", r.URL.Path)
+				denied.Inc()
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+
+			d := src.Policy().Decide(cert, r)
+			bifrost.Logger().InfoContext(
+				ctx, "authorization decision",
+				"allow", d.Allow,
+				"rule", d.Rule,
+				"id", cert.ID,
+				"namespace", cert.Namespace,
+				"method", r.Method,
+				"path", r.URL.Path,
+			)
+			if !d.Allow {
+				denied.Inc()
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			allowed.Inc()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package asgard
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: banned
+    effect: deny
+    ids: [3b6f0d8c-6b8e-4a56-9d8a-6c0f3f1f4a11]
+  - name: admins
+    ous: [admin]
+    paths: ["/admin/**"]
+  - name: workloads
+    sans: ["spiffe://example.org/ns/*/id/*"]
+    methods: [get, post]
+    paths: ["/api/*"]
+  - name: read-only
+    namespaces: [80485314-6c73-40ff-86c5-a5942a0f514f]
+    methods: [GET]
+    paths: ["/**"]
+`
+
+func TestPolicy_Decide(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	banned := uuid.MustParse("3b6f0d8c-6b8e-4a56-9d8a-6c0f3f1f4a11")
+	spiffeID, err := url.Parse("spiffe://example.org/ns/a/id/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert := func(ns, id uuid.UUID, ou string, uris ...*url.URL) *bifrost.Certificate {
+		c := &x509.Certificate{URIs: uris}
+		if ou != "" {
+			c.Subject = pkix.Name{OrganizationalUnit: []string{ou}}
+		}
+		return &bifrost.Certificate{Certificate: c, Namespace: ns, ID: id}
+	}
+
+	tests := []struct {
+		name   string
+		cert   *bifrost.Certificate
+		method string
+		path   string
+		want   Decision
+	}{
+		{"banned", newCert(ns, banned, "admin"), "GET", "/", Decision{false, "banned"}},
+		{"admin", newCert(uuid.New(), uuid.New(), "admin"), "DELETE", "/admin/users/1",
+			Decision{true, "admins"}},
+		{"admin root", newCert(uuid.New(), uuid.New(), "admin"), "GET", "/admin",
+			Decision{true, "admins"}},
+		{"admin prefix only", newCert(uuid.New(), uuid.New(), "admin"), "GET", "/administrator",
+			Decision{false, ""}},
+		{"workload", newCert(uuid.New(), uuid.New(), "", spiffeID), "POST", "/api/orders",
+			Decision{true, "workloads"}},
+		{"workload nested path", newCert(uuid.New(), uuid.New(), "", spiffeID), "POST",
+			"/api/orders/1", Decision{false, ""}},
+		{"read-only", newCert(ns, uuid.New(), ""), "GET", "/anything", Decision{true, "read-only"}},
+		{"read-only write", newCert(ns, uuid.New(), ""), "PUT", "/anything", Decision{false, ""}},
+		{"unknown", newCert(uuid.New(), uuid.New(), ""), "GET", "/", Decision{false, ""}},
+		{"banned double slash", newCert(ns, banned, ""), "GET", "//admin/x", Decision{false, "banned"}},
+		{"admin dot segment", newCert(uuid.New(), uuid.New(), "admin"), "GET", "/api/../admin/x",
+			Decision{true, "admins"}},
+		{"workload dot segment", newCert(uuid.New(), uuid.New(), "", spiffeID), "POST",
+			"/api/../admin/x", Decision{false, ""}},
+		{"workload double slash", newCert(uuid.New(), uuid.New(), "", spiffeID), "POST",
+			"/api//orders", Decision{true, "workloads"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if got := p.Decide(tc.cert, r); got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	allow, err := ParsePolicy([]byte(`{"default": "allow", "rules": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := allow.Decide(newCert(ns, uuid.New(), ""), httptest.NewRequest("GET", "/", nil)); !d.Allow {
+		t.Fatal("expected JSON allow by default policy to allow")
+	}
+}
+
+func TestParsePolicy_errors(t *testing.T) {
+	for _, in := range []string{
+		"default: maybe",
+		"rules: [{effect: permit}]",
+		`rules: [{paths: ["/["]}]`,
+		"rules: [{ids: [not-a-uuid]}]",
+		"rules: {}",
+		`rules: [{methods: [GET], path: ["/public/**"]}]`,
+		`{"rules": [{"method": ["GET"]}]}`,
+		"defualt: allow",
+	} {
+		if _, err := ParsePolicy([]byte(in)); err == nil {
+			t.Errorf("ParsePolicy(%q) expected error", in)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+	p, err := ParsePolicy([]byte(`rules: [{methods: [GET]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := Heimdallr(HeaderNameClientCert, ns)(
+		Authorize(p)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	for method, code := range map[string]int{
+		http.MethodGet:  http.StatusOK,
+		http.MethodPost: http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(method, "/", nil)
+		HeaderNameClientCert.Encode(req.Header, chain)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("%s: expected status %d, got %d", method, code, w.Code)
+		}
+	}
+
+	// A deny rule on /admin/** cannot be bypassed with non-canonical paths.
+	deny, err := ParsePolicy([]byte(`
+default: allow
+rules: [{effect: deny, paths: ["/admin/**"]}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = Heimdallr(HeaderNameClientCert, ns)(
+		Authorize(deny)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	for path, code := range map[string]int{
+		"/public/x":          http.StatusOK,
+		"/public/":           http.StatusOK,
+		"/admin/x":           http.StatusForbidden,
+		"//admin/x":          http.StatusBadRequest,
+		"/public/../admin/x": http.StatusBadRequest,
+		"/public/./x":        http.StatusBadRequest,
+		"/admin%2F..%2Fx":    http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if req.URL, err = url.ParseRequestURI(path); err != nil {
+			t.Fatal(err)
+		}
+		HeaderNameClientCert.Encode(req.Header, chain)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("%s: expected status %d, got %d", path, code, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Authorize(p)(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without client certificate, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(name, []byte("default: deny\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadPolicyFile(ctx, name, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Policy().Default != EffectDeny {
+		t.Fatalf("expected deny policy, got %q", f.Policy().Default)
+	}
+
+	// Invalid policies are ignored.
+	if err := os.WriteFile(name, []byte("default: nope\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if f.Policy().Default != EffectDeny {
+		t.Fatalf("expected deny policy, got %q", f.Policy().Default)
+	}
+
+	if err := os.WriteFile(name, []byte("default: allow\nrules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Policy().Default != EffectAllow {
+		if time.Now().After(deadline) {
+			t.Fatal("policy was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
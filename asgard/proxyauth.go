@@ -0,0 +1,242 @@
+package asgard
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RealImage/bifrost"
+)
+
+// HeaderNameProxySignature is the request header that carries the proxy signature
+// of a client certificate header, set by Hofund and checked by Heimdallr.
+// Its value is t=<unix seconds>;sig=<base64url signature>.
+// The signature covers the request method, host, and request URI along with the header,
+// so a proxy in between must forward them unchanged.
+const HeaderNameProxySignature = "X-Bifrost-Proxy-Signature"
+
+// MaxProxySignatureAge is how long Heimdallr accepts a proxy signature after it was made.
+const MaxProxySignatureAge = 5 * time.Minute
+
+// WithTrustedProxies returns an Option that makes Heimdallr only trust client
+// certificate headers in requests from source addresses in prefixes,
+// unless the request carries a valid proxy signature.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(o *options) {
+		o.trustedProxies = append(o.trustedProxies, prefixes...)
+	}
+}
+
+// WithProxyHMAC returns an Option that makes Hofund sign client certificate headers
+// with HMAC-SHA256 and key, and makes Heimdallr only trust headers with a valid HMAC,
+// unless the request comes from a trusted proxy address.
+func WithProxyHMAC(key []byte) Option {
+	return func(o *options) {
+		o.proxyHMACKey = key
+	}
+}
+
+// WithProxySigner returns an Option that makes Hofund sign client certificate headers
+// with key, which must be an ECDSA P-256, ECDSA P-384, or Ed25519 key.
+// Configure Heimdallr with the public key using [WithProxyPublicKey].
+// It returns an error if key is of another type.
+func WithProxySigner(key crypto.Signer) (Option, error) {
+	if key == nil {
+		return nil, errors.New("asgard: no proxy signing key")
+	}
+	if err := CheckProxyKey(key.Public()); err != nil {
+		return nil, err
+	}
+	return func(o *options) {
+		o.proxySigner = key
+	}, nil
+}
+
+// WithProxyPublicKey returns an Option that makes Heimdallr only trust client
+// certificate headers signed by the private key of pub,
+// unless the request comes from a trusted proxy address.
+// It returns an error if pub is not an ECDSA P-256, ECDSA P-384, or Ed25519 key.
+func WithProxyPublicKey(pub *bifrost.PublicKey) (Option, error) {
+	if pub == nil {
+		return nil, errors.New("asgard: no proxy public key")
+	}
+	if err := CheckProxyKey(pub.PublicKey); err != nil {
+		return nil, err
+	}
+	return func(o *options) {
+		o.proxyPublicKey = pub
+	}, nil
+}
+
+// CheckProxyKey returns an error unless pub is a public key that can sign proxy signatures,
+// an ECDSA P-256, ECDSA P-384, or Ed25519 key.
+func CheckProxyKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() || k.Curve == elliptic.P384() {
+			return nil
+		}
+		return fmt.Errorf("asgard: unsupported proxy signing key curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return nil
+	}
+	return fmt.Errorf("asgard: unsupported proxy signing key type %T", pub)
+}
+
+// enforcesProxyTrust reports whether Heimdallr must check where headers come from.
+func (o *options) enforcesProxyTrust() bool {
+	return len(o.trustedProxies) != 0 || o.proxyHMACKey != nil || o.proxyPublicKey != nil
+}
+
+// checkProxy returns an error unless r comes from a trusted proxy address
+// or carries a valid proxy signature for the h header.
+func (o *options) checkProxy(r *http.Request, h HeaderFormat, now time.Time) error {
+	if len(o.trustedProxies) != 0 {
+		if addr, err := remoteAddr(r); err == nil {
+			for _, p := range o.trustedProxies {
+				if p.Contains(addr) {
+					return nil
+				}
+			}
+		}
+	}
+	if o.proxyHMACKey == nil && o.proxyPublicKey == nil {
+		return fmt.Errorf("request from untrusted address %s", r.RemoteAddr)
+	}
+
+	sigHeader := r.Header.Get(HeaderNameProxySignature)
+	if sigHeader == "" {
+		return fmt.Errorf("missing proxy signature in request from %s", r.RemoteAddr)
+	}
+	ts, sig, err := parseProxySignature(sigHeader)
+	if err != nil {
+		return err
+	}
+	if age := now.Sub(ts); age > MaxProxySignatureAge || age < -MaxProxySignatureAge {
+		return fmt.Errorf("proxy signature made at %s is too old", ts)
+	}
+
+	msg := proxySignatureMessage(ts, h, r)
+	if o.proxyHMACKey != nil && hmac.Equal(sig, proxyHMAC(o.proxyHMACKey, msg)) {
+		return nil
+	}
+	if o.proxyPublicKey != nil && verifyProxySignature(o.proxyPublicKey, msg, sig) {
+		return nil
+	}
+	return errors.New("invalid proxy signature")
+}
+
+// signProxy sets the proxy signature of the h header in r, if Hofund signs headers.
+func (o *options) signProxy(r *http.Request, h HeaderFormat, now time.Time) error {
+	r.Header.Del(HeaderNameProxySignature)
+
+	var sig []byte
+	msg := proxySignatureMessage(now, h, r)
+	switch {
+	case o.proxySigner != nil:
+		hash, digest := proxySignatureDigest(o.proxySigner.Public(), msg)
+		var err error
+		if sig, err = o.proxySigner.Sign(rand.Reader, digest, hash); err != nil {
+			return err
+		}
+	case o.proxyHMACKey != nil:
+		sig = proxyHMAC(o.proxyHMACKey, msg)
+	default:
+		return nil
+	}
+
+	r.Header.Set(HeaderNameProxySignature, fmt.Sprintf("t=%d;sig=%s",
+		now.Unix(), base64.RawURLEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// proxySignatureMessage returns the signed message for the h header in r at time t.
+// It binds the header to the request method, host, and URI, so that a signature
+// cannot be replayed on other requests.
+func proxySignatureMessage(t time.Time, h HeaderFormat, r *http.Request) []byte {
+	return fmt.Appendf(nil, "bifrost-proxy-signature\n%d\n%s\n%s\n%s\n%s\n%s",
+		t.Unix(), r.Method, strings.ToLower(r.Host), r.URL.RequestURI(),
+		strings.ToLower(h.String()), strings.Join(r.Header.Values(h.String()), ","))
+}
+
+func parseProxySignature(value string) (time.Time, []byte, error) {
+	var ts time.Time
+	var sig []byte
+	for _, field := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case "t":
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return time.Time{}, nil, fmt.Errorf("invalid proxy signature time: %w", err)
+			}
+			ts = time.Unix(sec, 0)
+		case "sig":
+			var err error
+			if sig, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+				return time.Time{}, nil, fmt.Errorf("invalid proxy signature: %w", err)
+			}
+		}
+	}
+	if ts.IsZero() || len(sig) == 0 {
+		return time.Time{}, nil, errors.New("malformed proxy signature")
+	}
+	return ts, sig, nil
+}
+
+func proxyHMAC(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// proxySignatureDigest returns the hash and digest of msg to sign with a key of type pub.
+// Ed25519 keys sign msg itself.
+func proxySignatureDigest(pub crypto.PublicKey, msg []byte) (crypto.Hash, []byte) {
+	if k, ok := pub.(*ecdsa.PublicKey); ok {
+		if k.Curve == elliptic.P384() {
+			d := sha512.Sum384(msg)
+			return crypto.SHA384, d[:]
+		}
+		d := sha256.Sum256(msg)
+		return crypto.SHA256, d[:]
+	}
+	return crypto.Hash(0), msg
+}
+
+func verifyProxySignature(pub *bifrost.PublicKey, msg, sig []byte) bool {
+	_, digest := proxySignatureDigest(pub.PublicKey, msg)
+	switch k := pub.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest, sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, digest, sig)
+	}
+	return false
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,200 @@
+package asgard
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+func TestHeimdallr_trustedProxies(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+	hm := Heimdallr(HeaderNameEnvoyXFCC, ns,
+		WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")))
+	handler := hm(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for addr, code := range map[string]int{
+		"10.1.2.3:4567":    http.StatusOK,
+		"[fd00::1]:4567":   http.StatusOK,
+		"192.0.2.1:4567":   http.StatusUnauthorized,
+		"[2001:db8::1]:80": http.StatusUnauthorized,
+	} {
+		t.Run(addr, func(t *testing.T) {
+			rejected := newHeimdallrMetrics(ns).rejected(reasonUntrustedProxy).Get()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = addr
+			HeaderNameEnvoyXFCC.Encode(req.Header, chain)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != code {
+				t.Fatalf("expected status %d, got %d", code, w.Code)
+			}
+			if code == http.StatusUnauthorized {
+				if got := newHeimdallrMetrics(ns).rejected(reasonUntrustedProxy).Get(); got != rejected+1 {
+					t.Fatalf("expected rejections to be %d, got %d", rejected+1, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHofund_Heimdallr_proxySignature(t *testing.T) {
+	ns := uuid.New()
+	chain := newTestChain(t, ns)
+
+	edKey, err := bifrost.NewEd25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := bifrost.NewP384PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := []byte("correct horse battery staple")
+
+	tests := []struct {
+		name    string
+		hofund  []Option
+		heim    []Option
+		tamper  func(*http.Request)
+		wantErr bool
+	}{
+		{"hmac", []Option{WithProxyHMAC(hmacKey)}, []Option{WithProxyHMAC(hmacKey)}, nil, false},
+		{
+			"ed25519", []Option{mustOption(WithProxySigner(edKey))},
+			[]Option{mustOption(WithProxyPublicKey(edKey.PublicKey()))}, nil, false,
+		},
+		{
+			"p384", []Option{mustOption(WithProxySigner(p384Key))},
+			[]Option{mustOption(WithProxyPublicKey(p384Key.PublicKey()))}, nil, false,
+		},
+		{"unsigned", nil, []Option{WithProxyHMAC(hmacKey)}, nil, true},
+		{
+			"wrong hmac key", []Option{WithProxyHMAC([]byte("wrong"))},
+			[]Option{WithProxyHMAC(hmacKey)}, nil, true,
+		},
+		{
+			"wrong public key", []Option{mustOption(WithProxySigner(edKey))},
+			[]Option{mustOption(WithProxyPublicKey(otherKey.PublicKey()))}, nil, true,
+		},
+		{
+			"tampered header", []Option{WithProxyHMAC(hmacKey)}, []Option{WithProxyHMAC(hmacKey)},
+			func(r *http.Request) {
+				HeaderNameEnvoyXFCC.Encode(r.Header, chain[1:])
+			}, true,
+		},
+		{
+			"replayed on another path", []Option{WithProxyHMAC(hmacKey)},
+			[]Option{WithProxyHMAC(hmacKey)},
+			func(r *http.Request) { r.URL.Path = "/admin" }, true,
+		},
+		{
+			"replayed with another method", []Option{mustOption(WithProxySigner(edKey))},
+			[]Option{mustOption(WithProxyPublicKey(edKey.PublicKey()))},
+			func(r *http.Request) { r.Method = http.MethodDelete }, true,
+		},
+		{
+			"replayed on another host", []Option{WithProxyHMAC(hmacKey)},
+			[]Option{WithProxyHMAC(hmacKey)},
+			func(r *http.Request) { r.Host = "other.example.com" }, true,
+		},
+		{
+			"stale signature", []Option{WithProxyHMAC(hmacKey)}, []Option{WithProxyHMAC(hmacKey)},
+			func(r *http.Request) {
+				o := newOptions([]Option{WithProxyHMAC(hmacKey)})
+				if err := o.signProxy(r, HeaderNameEnvoyXFCC, time.Now().Add(-time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}, true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := Heimdallr(HeaderNameEnvoyXFCC, ns, tc.heim...)(
+				http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			tamper := func(r *http.Request) {}
+			if tc.tamper != nil {
+				tamper = tc.tamper
+			}
+			proxy := Hofund(HeaderNameEnvoyXFCC, ns, tc.hofund...)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					tamper(r)
+					backend.ServeHTTP(w, r)
+				}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: chain}
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			code := http.StatusOK
+			if tc.wantErr {
+				code = http.StatusUnauthorized
+			}
+			if w.Code != code {
+				t.Fatalf("expected status %d, got %d", code, w.Code)
+			}
+		})
+	}
+}
+
+func TestCheckProxyKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "p521": p521Key} {
+		if err := CheckProxyKey(key.Public()); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if _, err := WithProxySigner(key); err == nil {
+			t.Errorf("%s: expected WithProxySigner error", name)
+		}
+	}
+	if _, err := WithProxySigner(nil); err == nil {
+		t.Error("expected WithProxySigner error for a nil key")
+	}
+	if _, err := WithProxyPublicKey(nil); err == nil {
+		t.Error("expected WithProxyPublicKey error for a nil key")
+	}
+	if _, err := WithProxyPublicKey(&bifrost.PublicKey{PublicKey: rsaKey.Public()}); err == nil {
+		t.Error("expected WithProxyPublicKey error for an RSA key")
+	}
+
+	edKey, err := bifrost.NewEd25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckProxyKey(edKey.Public()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustOption(opt Option, err error) Option {
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
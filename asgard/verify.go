@@ -0,0 +1,110 @@
+package asgard
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/google/uuid"
+)
+
+// Reasons for rejecting client certificates, used as metric labels.
+const (
+	reasonExpired     = "expired"
+	reasonNotYetValid = "not_yet_valid"
+	reasonUntrusted   = "untrusted"
+	reasonInvalid     = "invalid"
+	reasonNamespace   = "namespace"
+
+	reasonUntrustedProxy = "untrusted_proxy"
+)
+
+// parseCerts returns chain as bifrost certificates.
+func (o *options) parseCerts(chain []*x509.Certificate) ([]*bifrost.Certificate, error) {
+	certs := make([]*bifrost.Certificate, len(chain))
+	for i, c := range chain {
+		var err error
+		if certs[i], err = bifrost.NewCertificate(c, o.parseOpts...); err != nil {
+			return nil, err
+		}
+	}
+	return certs, nil
+}
+
+// verifyCerts verifies the client certificate certs[0] against the trust pool,
+// with the rest of certs as intermediates, and returns the verified chain.
+// Without a trust pool, certs is returned as is.
+func (o *options) verifyCerts(certs []*bifrost.Certificate, at time.Time) ([]*bifrost.Certificate, error) {
+	if len(o.trustPool) == 0 {
+		return certs, nil
+	}
+	return verifyClientCert(certs[0], o.trustPool, certs[1:], at)
+}
+
+// verifyClientCert checks that cert chains up to a CA in roots through intermediates,
+// is valid at time at, and can be used for client authentication.
+// It returns the verified chain from cert to its root.
+func verifyClientCert(
+	cert *bifrost.Certificate,
+	roots, intermediates []*bifrost.Certificate,
+	at time.Time,
+) ([]*bifrost.Certificate, error) {
+	chain, err := cert.Verify(roots, intermediates, at)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, fmt.Errorf("%w, key usage does not allow digital signatures",
+			bifrost.ErrCertificateInvalid)
+	}
+	if len(cert.ExtKeyUsage) != 0 &&
+		!slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth) &&
+		!slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageAny) {
+		return nil, fmt.Errorf("%w, extended key usage does not allow client authentication",
+			bifrost.ErrCertificateInvalid)
+	}
+	return chain, nil
+}
+
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, bifrost.ErrCertificateExpired):
+		return reasonExpired
+	case errors.Is(err, bifrost.ErrCertificateNotYetValid):
+		return reasonNotYetValid
+	case errors.Is(err, bifrost.ErrCertificateUntrusted):
+		return reasonUntrusted
+	}
+	return reasonInvalid
+}
+
+type heimdallrMetrics struct {
+	ns       uuid.UUID
+	accepted *metrics.Counter
+}
+
+func newHeimdallrMetrics(ns uuid.UUID) *heimdallrMetrics {
+	m := &heimdallrMetrics{
+		ns: ns,
+		accepted: bifrost.StatsForNerds.GetOrCreateCounter(
+			fmt.Sprintf(`bifrost_heimdallr_accepted_total{ns="%s"}`, ns)),
+	}
+	// Create rejection counters up front so they are exported before the first rejection.
+	for _, r := range []string{
+		reasonExpired, reasonNotYetValid, reasonUntrusted, reasonInvalid, reasonNamespace,
+		reasonUntrustedProxy,
+	} {
+		m.rejected(r)
+	}
+	return m
+}
+
+func (m *heimdallrMetrics) rejected(reason string) *metrics.Counter {
+	return bifrost.StatsForNerds.GetOrCreateCounter(
+		fmt.Sprintf(`bifrost_heimdallr_rejected_total{ns="%s",reason="%s"}`, m.ns, reason))
+}
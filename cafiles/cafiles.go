@@ -1,14 +1,19 @@
 // cafiles can fetch CA certificate and private key PEM files from many storage backends.
 // PEM encoded CA files can be fetched from local filesystem, AWS S3, or AWS Secrets Manager.
+// CA private keys can also be kept in a PKCS#11 token, such as an HSM, or in AWS KMS,
+// and used through a [crypto.Signer].
 package cafiles
 
 import (
 	"context"
+	"crypto"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"strings"
 
 	"github.com/RealImage/bifrost"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -41,18 +46,118 @@ func GetCertificate(ctx context.Context, uri string) (*bifrost.Certificate, erro
 	return cert, nil
 }
 
+// GetCertificateChain returns the bifrost certificates in the PEM file at uri.
+// uri can be any uri supported by [GetCertificate].
+// The first certificate is the CA certificate, and the rest are the intermediate
+// CA certificates that link it to a root, each one signing the certificate before it.
+// Every certificate is validated before returning.
+func GetCertificateChain(ctx context.Context, uri string) ([]*bifrost.Certificate, error) {
+	certPem, err := getPemFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificates(certPem)
+}
+
+// GetTrustPool returns the bifrost CA certificates in the PEM files at uris,
+// such as for asgard.WithTrustPool.
+// Each uri can be any uri supported by [GetCertificate], and hold any number of certificates.
+func GetTrustPool(ctx context.Context, uris ...string) ([]*bifrost.Certificate, error) {
+	var pool []*bifrost.Certificate
+	for _, uri := range uris {
+		certs, err := GetCertificateChain(ctx, uri)
+		if err != nil {
+			return nil, fmt.Errorf("error getting certificates from %s: %w", uri, err)
+		}
+		for _, cert := range certs {
+			if !cert.IsCA() {
+				return nil, fmt.Errorf("certificate %s in %s is not a CA", cert.ID, uri)
+			}
+		}
+		pool = append(pool, certs...)
+	}
+	return pool, nil
+}
+
+func parseCertificates(certPem []byte) ([]*bifrost.Certificate, error) {
+	var chain []*bifrost.Certificate
+	for block, rest := pem.Decode(certPem); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := bifrost.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error validating certificate %d: %w", len(chain), err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("expected PEM block")
+	}
+
+	return chain, nil
+}
+
+// PassphraseFunc returns the passphrase for the encrypted private key at uri.
+type PassphraseFunc func(ctx context.Context, uri string) ([]byte, error)
+
+// Option configures how CA files are fetched and parsed.
+type Option func(*options)
+
+type options struct {
+	passphrase  PassphraseFunc
+	kmsEndpoint string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPassphrase returns an Option that decrypts encrypted private keys
+// with the passphrase returned by fn.
+// fn is only called if the private key is encrypted.
+func WithPassphrase(fn PassphraseFunc) Option {
+	return func(o *options) {
+		o.passphrase = fn
+	}
+}
+
+// WithKMSEndpoint returns an Option that sends AWS KMS requests to endpoint
+// instead of the default regional endpoint, such as a local KMS stand-in.
+func WithKMSEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.kmsEndpoint = endpoint
+	}
+}
+
 // GetPrivateKey retrieves a PEM encoded private key from uri.
 // uri can be one of a relative or absolute file path, file://... uri, s3://... uri,
 // or an AWS S3 or AWS Secrets Manager ARN.
 // The private key can either be PEM encoded PKCS#8 or SEC1, ASN.1 DER form.
-func GetPrivateKey(ctx context.Context, uri string) (*bifrost.PrivateKey, error) {
+// Encrypted PKCS#8 private keys are decrypted if a passphrase is provided with
+// [WithPassphrase], otherwise the returned error wraps [bifrost.ErrPrivateKeyEncrypted].
+func GetPrivateKey(ctx context.Context, uri string, opts ...Option) (*bifrost.PrivateKey, error) {
+	o := newOptions(opts)
+
 	pemData, err := getPemFile(ctx, uri)
 	if err != nil {
 		return nil, fmt.Errorf("error getting file %s: %w", uri, err)
 	}
 
 	var key bifrost.PrivateKey
-	if err := key.UnmarshalText(pemData); err != nil {
+	err = key.UnmarshalText(pemData)
+	if errors.Is(err, bifrost.ErrPrivateKeyEncrypted) && o.passphrase != nil {
+		var passphrase []byte
+		if passphrase, err = o.passphrase(ctx, uri); err != nil {
+			return nil, fmt.Errorf("error getting passphrase: %w", err)
+		}
+		err = key.UnmarshalEncryptedText(pemData, passphrase)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("error parsing private key: %w", err)
 	}
 	return &key, nil
@@ -147,13 +252,14 @@ func GetCertKey(
 	ctx context.Context,
 	certUri string,
 	keyUri string,
+	opts ...Option,
 ) (*bifrost.Certificate, *bifrost.PrivateKey, error) {
 	cert, err := GetCertificate(ctx, certUri)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting cert: %w", err)
 	}
 
-	key, err := GetPrivateKey(ctx, keyUri)
+	key, err := GetPrivateKey(ctx, keyUri, opts...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting key: %w", err)
 	}
@@ -163,3 +269,89 @@ func GetCertKey(
 	}
 	return cert, key, nil
 }
+
+// GetSigner returns a signer for the private key at uri.
+// uri can be a PKCS#11 URI (RFC 7512), an AWS KMS key ARN,
+// or any uri supported by [GetPrivateKey].
+//
+// PKCS#11 URIs identify the token by token, serial, or slot-id, and the key
+// by object label or id. The module-path query attribute is required,
+// and the PIN can be provided with the pin-value or pin-source query attributes.
+//
+//	pkcs11:token=bifrost;object=ca?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=pin.txt
+//
+// PKCS#11 signers require bifrost to be built with cgo.
+//
+// AWS KMS keys must be ECC_NIST_P256 or ECC_NIST_P384 keys with the SIGN_VERIFY key usage.
+// Use [WithKMSEndpoint] to sign with a KMS compatible service at a custom endpoint.
+func GetSigner(ctx context.Context, uri string, opts ...Option) (crypto.Signer, error) {
+	switch {
+	case strings.HasPrefix(uri, pkcs11Scheme):
+		return getPKCS11Signer(ctx, uri)
+	case isKMSArn(uri):
+		return getKMSSigner(ctx, uri, newOptions(opts))
+	}
+	// Return a nil interface on error, not a nil *bifrost.PrivateKey.
+	key, err := GetPrivateKey(ctx, uri, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetCertSigner returns a bifrost certificate from certUri and a signer from keyUri.
+// keyUri can be any uri supported by [GetSigner].
+func GetCertSigner(
+	ctx context.Context,
+	certUri string,
+	keyUri string,
+	opts ...Option,
+) (*bifrost.Certificate, crypto.Signer, error) {
+	cert, err := GetCertificate(ctx, certUri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting cert: %w", err)
+	}
+
+	signer, err := getMatchingSigner(ctx, cert, keyUri, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, signer, nil
+}
+
+// GetCertChainSigner returns a bifrost certificate chain from certUri and a signer from keyUri.
+// The signer must match the first certificate in the chain, see [GetCertificateChain].
+func GetCertChainSigner(
+	ctx context.Context,
+	certUri string,
+	keyUri string,
+	opts ...Option,
+) ([]*bifrost.Certificate, crypto.Signer, error) {
+	chain, err := GetCertificateChain(ctx, certUri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting cert: %w", err)
+	}
+
+	signer, err := getMatchingSigner(ctx, chain[0], keyUri, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, signer, nil
+}
+
+func getMatchingSigner(
+	ctx context.Context,
+	cert *bifrost.Certificate,
+	keyUri string,
+	opts []Option,
+) (crypto.Signer, error) {
+	signer, err := GetSigner(ctx, keyUri, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting key: %w", err)
+	}
+
+	if !cert.IssuedTo(&bifrost.PublicKey{PublicKey: signer.Public()}) {
+		return nil, fmt.Errorf("certificate and key do not match")
+	}
+	return signer, nil
+}
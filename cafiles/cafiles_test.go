@@ -0,0 +1,16 @@
+package cafiles
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetSigner_error(t *testing.T) {
+	signer, err := GetSigner(context.Background(), "testdata/missing-key.pem")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if signer != nil {
+		t.Fatalf("expected a nil signer, got %#v", signer)
+	}
+}
@@ -0,0 +1,112 @@
+package cafiles
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// kmsAPI is the subset of the AWS KMS client used by kmsSigner.
+type kmsAPI interface {
+	GetPublicKey(context.Context, *kms.GetPublicKeyInput, ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(context.Context, *kms.SignInput, ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// kmsSigner is a crypto.Signer backed by an asymmetric ECC_NIST_P256 or
+// ECC_NIST_P384 AWS KMS key. The private key never leaves KMS.
+type kmsSigner struct {
+	client kmsAPI
+	keyID  string
+	public *ecdsa.PublicKey
+}
+
+func isKMSArn(uri string) bool {
+	a, err := arn.Parse(uri)
+	return err == nil && a.Service == "kms"
+}
+
+func getKMSSigner(ctx context.Context, keyArn string, o *options) (crypto.Signer, error) {
+	a, err := arn.Parse(keyArn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing arn %w", err)
+	}
+
+	sdkConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(a.Region))
+	if err != nil {
+		return nil, fmt.Errorf("error loading aws config: %w", err)
+	}
+
+	client := kms.NewFromConfig(sdkConfig, func(opts *kms.Options) {
+		if o.kmsEndpoint != "" {
+			opts.BaseEndpoint = aws.String(o.kmsEndpoint)
+		}
+	})
+	return newKMSSigner(ctx, client, keyArn)
+}
+
+func newKMSSigner(ctx context.Context, client kmsAPI, keyID string) (crypto.Signer, error) {
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting kms public key: %w", err)
+	}
+
+	if out.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("kms key usage must be %s, got %s",
+			types.KeyUsageTypeSignVerify, out.KeyUsage)
+	}
+	if ks := out.KeySpec; ks != types.KeySpecEccNistP256 && ks != types.KeySpecEccNistP384 {
+		return nil, fmt.Errorf("unsupported kms key spec %s", ks)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing kms public key: %w", err)
+	}
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected kms public key type %T", pub)
+	}
+
+	return &kmsSigner{client: client, keyID: keyID, public: ecPub}, nil
+}
+
+// Public returns the public key of the KMS key.
+func (k *kmsSigner) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs digest with the KMS key.
+// The returned signature is ASN.1 DER encoded, as expected by crypto/x509.
+func (k *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var alg types.SigningAlgorithmSpec
+	switch h := opts.HashFunc(); h {
+	case crypto.SHA256:
+		alg = types.SigningAlgorithmSpecEcdsaSha256
+	case crypto.SHA384:
+		alg = types.SigningAlgorithmSpecEcdsaSha384
+	case crypto.SHA512:
+		alg = types.SigningAlgorithmSpecEcdsaSha512
+	default:
+		return nil, fmt.Errorf("unsupported kms signing hash %s", h)
+	}
+
+	out, err := k.client.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String(k.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: alg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error signing with kms: %w", err)
+	}
+	return out.Signature, nil
+}
@@ -0,0 +1,147 @@
+package cafiles
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/google/uuid"
+)
+
+const testKMSArn = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+// fakeKMS is a local KMS stand-in that implements GetPublicKey and Sign.
+func fakeKMS(t *testing.T, key *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	pubDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			KeyId            string
+			Message          []byte
+			MessageType      string
+			SigningAlgorithm string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.KeyId != testKMSArn {
+			http.Error(w, "unknown key", http.StatusBadRequest)
+			return
+		}
+
+		var resp any
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			resp = map[string]any{
+				"KeyId":     req.KeyId,
+				"KeySpec":   "ECC_NIST_P256",
+				"KeyUsage":  "SIGN_VERIFY",
+				"PublicKey": pubDer,
+			}
+		case "TrentService.Sign":
+			if req.MessageType != "DIGEST" || req.SigningAlgorithm != "ECDSA_SHA_256" {
+				http.Error(w, "unexpected signing request", http.StatusBadRequest)
+				return
+			}
+			sig, err := ecdsa.SignASN1(rand.Reader, key, req.Message)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp = map[string]any{
+				"KeyId":            req.KeyId,
+				"Signature":        sig,
+				"SigningAlgorithm": req.SigningAlgorithm,
+			}
+		default:
+			http.Error(w, "unsupported operation", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestGetSigner_kms(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeKMS(t, key)
+	defer srv.Close()
+
+	ctx := context.Background()
+	signer, err := GetSigner(ctx, testKMSArn, WithKMSEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(signer.Public()) {
+		t.Fatal("expected kms public key to match")
+	}
+
+	digest := sha256.Sum256([]byte("bifrost"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Fatal("expected valid signature")
+	}
+
+	// Self-sign a CA certificate, like bf new ca.
+	pub := &bifrost.PublicKey{PublicKey: signer.Public()}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	template.Subject.CommonName = pub.UUID(uuid.New()).String()
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, pub.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetSigner_kmsUnsupportedHash(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &kmsSigner{keyID: testKMSArn, public: &key.PublicKey}
+	if _, err := s.Sign(rand.Reader, []byte("digest"), crypto.Hash(0)); err == nil {
+		t.Fatal("expected error for unsupported hash")
+	}
+}
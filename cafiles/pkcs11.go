@@ -0,0 +1,115 @@
+package cafiles
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const pkcs11Scheme = "pkcs11:"
+
+// pkcs11URI holds the attributes of a PKCS#11 URI as defined in RFC 7512.
+// Only the attributes needed to locate a signing key are supported.
+type pkcs11URI struct {
+	modulePath string
+	token      string
+	serial     string
+	slotID     *int
+	object     string
+	id         []byte
+	pin        string
+}
+
+// parsePKCS11URI parses uri into its path and query attributes.
+// A PIN may be provided inline with pin-value or read from a file with pin-source.
+func parsePKCS11URI(uri string) (*pkcs11URI, error) {
+	rest, ok := strings.CutPrefix(uri, pkcs11Scheme)
+	if !ok {
+		return nil, fmt.Errorf("pkcs11 uri must start with %q", pkcs11Scheme)
+	}
+	path, query, _ := strings.Cut(rest, "?")
+
+	var p pkcs11URI
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		k, v, err := splitPKCS11Attr(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case "token":
+			p.token = v
+		case "serial":
+			p.serial = v
+		case "slot-id":
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pkcs11 slot-id %q: %w", v, err)
+			}
+			p.slotID = &id
+		case "object":
+			p.object = v
+		case "id":
+			p.id = []byte(v)
+		case "type":
+			if v != "private" {
+				return nil, fmt.Errorf("pkcs11 object type must be private, got %q", v)
+			}
+		}
+	}
+
+	var pinSource string
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		k, v, err := splitPKCS11Attr(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case "module-path":
+			p.modulePath = v
+		case "pin-value":
+			p.pin = v
+		case "pin-source":
+			pinSource = v
+		}
+	}
+
+	if p.modulePath == "" {
+		return nil, fmt.Errorf("pkcs11 uri requires a module-path query attribute")
+	}
+	if p.token == "" && p.serial == "" && p.slotID == nil {
+		return nil, fmt.Errorf("pkcs11 uri requires one of token, serial, or slot-id")
+	}
+	if p.object == "" && p.id == nil {
+		return nil, fmt.Errorf("pkcs11 uri requires one of object or id")
+	}
+
+	if pinSource != "" && p.pin == "" {
+		pin, err := os.ReadFile(strings.TrimPrefix(pinSource, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading pkcs11 pin-source: %w", err)
+		}
+		p.pin = strings.TrimRight(string(pin), "\r\n")
+	}
+
+	return &p, nil
+}
+
+func splitPKCS11Attr(attr string) (string, string, error) {
+	k, v, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid pkcs11 uri attribute %q", attr)
+	}
+	v, err := url.PathUnescape(v)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid pkcs11 uri attribute %q: %w", attr, err)
+	}
+	return k, v, nil
+}
@@ -0,0 +1,51 @@
+//go:build cgo
+
+package cafiles
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// getPKCS11Signer returns a signer for the key pair identified by uri.
+// The PKCS#11 module stays loaded for the lifetime of the process.
+func getPKCS11Signer(_ context.Context, uri string) (crypto.Signer, error) {
+	p, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// crypto11 selects a token by exactly one of label, serial, or slot.
+	cfg := crypto11.Config{Path: p.modulePath, Pin: p.pin}
+	switch {
+	case p.token != "":
+		cfg.TokenLabel = p.token
+	case p.serial != "":
+		cfg.TokenSerial = p.serial
+	default:
+		cfg.SlotNumber = p.slotID
+	}
+
+	c, err := crypto11.Configure(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring pkcs11 module: %w", err)
+	}
+
+	var label []byte
+	if p.object != "" {
+		label = []byte(p.object)
+	}
+	signer, err := c.FindKeyPair(p.id, label)
+	if err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("error finding pkcs11 key pair: %w", err)
+	}
+	if signer == nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("pkcs11 key pair not found")
+	}
+	return signer, nil
+}
@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package cafiles
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+)
+
+func getPKCS11Signer(_ context.Context, uri string) (crypto.Signer, error) {
+	if _, err := parsePKCS11URI(uri); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("pkcs11 keys are not supported, bifrost was built without cgo")
+}
@@ -0,0 +1,83 @@
+package cafiles
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var parsePKCS11URITests = []struct {
+	uri      string
+	expected *pkcs11URI
+	err      bool
+}{
+	{
+		uri: "pkcs11:token=bifrost;object=ca?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+		expected: &pkcs11URI{
+			modulePath: "/usr/lib/softhsm/libsofthsm2.so",
+			token:      "bifrost",
+			object:     "ca",
+			pin:        "1234",
+		},
+	},
+	{
+		uri: "pkcs11:slot-id=2;id=%01%02;type=private?module-path=/lib/p11.so",
+		expected: &pkcs11URI{
+			modulePath: "/lib/p11.so",
+			slotID:     func() *int { i := 2; return &i }(),
+			id:         []byte{1, 2},
+		},
+	},
+	{
+		uri: "pkcs11:serial=abc;object=my%20key?module-path=/lib/p11.so",
+		expected: &pkcs11URI{
+			modulePath: "/lib/p11.so",
+			serial:     "abc",
+			object:     "my key",
+		},
+	},
+	{uri: "pkcs11:token=bifrost;object=ca", err: true},
+	{uri: "pkcs11:object=ca?module-path=/lib/p11.so", err: true},
+	{uri: "pkcs11:token=bifrost?module-path=/lib/p11.so", err: true},
+	{uri: "pkcs11:token=bifrost;object=ca;type=public?module-path=/lib/p11.so", err: true},
+	{uri: "pkcs11:slot-id=one;object=ca?module-path=/lib/p11.so", err: true},
+	{uri: "file:///key.pem", err: true},
+}
+
+func TestParsePKCS11URI(t *testing.T) {
+	for _, tc := range parsePKCS11URITests {
+		t.Run(tc.uri, func(t *testing.T) {
+			p, err := parsePKCS11URI(tc.uri)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, p)
+			}
+		})
+	}
+}
+
+func TestParsePKCS11URI_pinSource(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin.txt")
+	if err := os.WriteFile(pinFile, []byte("1234\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := parsePKCS11URI(
+		"pkcs11:token=bifrost;object=ca?module-path=/lib/p11.so&pin-source=file:" + pinFile,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.pin != "1234" {
+		t.Fatalf("expected pin 1234, got %q", p.pin)
+	}
+}
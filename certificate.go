@@ -1,17 +1,31 @@
 package bifrost
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 )
 
+// PEM block types of certificates and certificate requests.
+const (
+	pemTypeCertificate        = "CERTIFICATE"
+	pemTypeCertificateRequest = "CERTIFICATE REQUEST"
+)
+
 // Certificate is a bifrost certificate.
 // It embeds the x509 certificate and adds the bifrost ID, namespace, and public key.
+// Certificate implements the Marshaler and Unmarshaler interfaces for binary, text, JSON, and DynamoDB.
+// Certificates are serialised in ASN.1 DER form and validated when unmarshaled.
 type Certificate struct {
 	*x509.Certificate
 
@@ -27,20 +41,53 @@ func (c Certificate) IsCA() bool {
 		c.Certificate.KeyUsage&x509.KeyUsageCertSign != 0
 }
 
+// ParseOption configures how certificates, certificate requests, keys, and identities
+// are validated.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	allowRSA     bool
+	trustDomains TrustDomains
+}
+
+func newParseOptions(opts []ParseOption) *parseOptions {
+	o := &parseOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// AllowLegacyRSA returns a ParseOption that accepts RSA keys
+// of at least [MinimumRSAKeySize] bits.
+// Use this only for clients that cannot generate ECDSA or Ed25519 keys.
+func AllowLegacyRSA() ParseOption {
+	return func(o *parseOptions) {
+		o.allowRSA = true
+	}
+}
+
 // ParseCertificate parses a DER encoded certificate and validates it.
 // On success, it returns the bifrost certificate.
-func ParseCertificate(asn1Data []byte) (*Certificate, error) {
+func ParseCertificate(asn1Data []byte, opts ...ParseOption) (*Certificate, error) {
 	cert, err := x509.ParseCertificate(asn1Data)
 	if err != nil {
 		return nil, err
 	}
-	return NewCertificate(cert)
+	return NewCertificate(cert, opts...)
 }
 
 // NewCertificate creates a bifrost certificate from an x509 certificate.
 // It checks for the correct signature algorithm, identity namespace, and identity.
 // On success, it sets the ID, Namespace, and PublicKey fields.
-func NewCertificate(cert *x509.Certificate) (*Certificate, error) {
+//
+// The identity is read from the subject O (namespace) and CN (UUID) fields.
+// SPIFFE ID and urn:uuid URI SANs, if present, must name the same identity,
+// and certificates with an empty subject can carry their identity in a SPIFFE ID alone.
+// See [SPIFFEID], [UUIDURN], and [WithTrustDomains].
+func NewCertificate(cert *x509.Certificate, opts ...ParseOption) (*Certificate, error) {
+	o := newParseOptions(opts)
+
 	if cert.IsCA {
 		if !cert.BasicConstraintsValid {
 			return nil, fmt.Errorf("%w, basic constraints not valid", ErrCertificateInvalid)
@@ -52,7 +99,7 @@ func NewCertificate(cert *x509.Certificate) (*Certificate, error) {
 	}
 
 	// Check for bifrost signature algorithm
-	if cert.SignatureAlgorithm != SignatureAlgorithm {
+	if !isSignatureAlgorithmSupported(cert.SignatureAlgorithm) {
 		return nil, fmt.Errorf(
 			"%w, unsupported signature algorithm '%s'",
 			ErrRequestInvalid,
@@ -60,49 +107,38 @@ func NewCertificate(cert *x509.Certificate) (*Certificate, error) {
 		)
 	}
 
-	// Parse identity namespace
-	if len(cert.Subject.Organization) != 1 {
-		return nil, fmt.Errorf("%w, missing identity namespace", ErrCertificateInvalid)
-	}
-	rawNS := cert.Subject.Organization[0]
-	ns, err := uuid.Parse(rawNS)
+	uriNS, uriID, err := o.uriIdentity(cert.URIs)
 	if err != nil {
-		return nil, fmt.Errorf(
-			"%w, invalid identity namespace %s: %w",
-			ErrCertificateInvalid,
-			rawNS,
-			err,
-		)
+		return nil, err
+	}
+
+	// Certificates without a subject identity can carry it in URI SANs alone.
+	var ns, cid uuid.UUID
+	if len(cert.Subject.Organization) == 0 && cert.Subject.CommonName == "" && uriID != uuid.Nil {
+		ns, cid = uriNS, uriID
+	} else if ns, cid, err = subjectIdentity(cert.Subject); err != nil {
+		return nil, err
 	}
 	if ns == uuid.Nil {
-		return nil, fmt.Errorf("%w, nil identity namespace", ErrCertificateInvalid)
+		return nil, fmt.Errorf("%w, missing identity namespace", ErrCertificateInvalid)
+	}
+	if uriNS != uuid.Nil && uriNS != ns {
+		return nil, fmt.Errorf("%w, URI SAN namespace does not match subject", ErrCertificateInvalid)
+	}
+	if uriID != uuid.Nil && uriID != cid {
+		return nil, fmt.Errorf("%w, URI SAN identity does not match subject", ErrCertificateInvalid)
 	}
 
-	pubkey, ok := cert.PublicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf(
-			"%w, invalid public key type: '%T'",
-			ErrCertificateInvalid,
-			cert.PublicKey,
-		)
+	if err := o.checkKey(cert.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrCertificateInvalid, err)
 	}
 
 	pk := &PublicKey{
-		PublicKey: pubkey,
+		PublicKey: cert.PublicKey,
 	}
 
 	// Check if calculated UUID matches the UUID in the certificate
 	id := pk.UUID(ns)
-
-	cid, err := uuid.Parse(cert.Subject.CommonName)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"%w, invalid subj CN '%s', %s",
-			ErrCertificateInvalid,
-			cert.Subject.CommonName,
-			err.Error(),
-		)
-	}
 	if cid != id {
 		return nil, fmt.Errorf("%w, incorrect identity", ErrCertificateInvalid)
 	}
@@ -117,11 +153,125 @@ func NewCertificate(cert *x509.Certificate) (*Certificate, error) {
 	return bfCert, nil
 }
 
+// subjectIdentity returns the namespace in subject O and the identity in subject CN.
+func subjectIdentity(subject pkix.Name) (uuid.UUID, uuid.UUID, error) {
+	if len(subject.Organization) != 1 {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("%w, missing identity namespace", ErrCertificateInvalid)
+	}
+	rawNS := subject.Organization[0]
+	ns, err := uuid.Parse(rawNS)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf(
+			"%w, invalid identity namespace %s: %w",
+			ErrCertificateInvalid,
+			rawNS,
+			err,
+		)
+	}
+	if ns == uuid.Nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("%w, nil identity namespace", ErrCertificateInvalid)
+	}
+
+	cid, err := uuid.Parse(subject.CommonName)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf(
+			"%w, invalid subj CN '%s', %s",
+			ErrCertificateInvalid,
+			subject.CommonName,
+			err.Error(),
+		)
+	}
+	return ns, cid, nil
+}
+
 // IssuedTo returns true if the certificate was issued to the given public key.
 func (c *Certificate) IssuedTo(key *PublicKey) bool {
 	return c.PublicKey.Equal(key)
 }
 
+// checkValidity returns an error if cert is not valid at time at.
+func checkValidity(cert *x509.Certificate, at time.Time) error {
+	if at.Before(cert.NotBefore) {
+		return fmt.Errorf("%w, %s valid from %s",
+			ErrCertificateNotYetValid, cert.Subject.CommonName, cert.NotBefore)
+	}
+	if at.After(cert.NotAfter) {
+		return fmt.Errorf("%w, %s valid until %s",
+			ErrCertificateExpired, cert.Subject.CommonName, cert.NotAfter)
+	}
+	return nil
+}
+
+// Verify verifies that c chains up to one of roots through intermediates at time at.
+// If at is zero, the current time is used.
+// Every certificate in the chain must be signed by the next, be valid at time at,
+// and be a bifrost certificate in the same namespace as c.
+// Issuing certificates must be CAs and respect path length constraints.
+// On success, Verify returns the chain from c to its root.
+// The returned error wraps [ErrCertificateInvalid], and one of [ErrCertificateExpired],
+// [ErrCertificateNotYetValid], or [ErrCertificateUntrusted] when that is the cause.
+func (c *Certificate) Verify(roots, intermediates []*Certificate, at time.Time) ([]*Certificate, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if err := checkValidity(c.Certificate, at); err != nil {
+		return nil, err
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, r := range roots {
+		opts.Roots.AddCert(r.Certificate)
+	}
+	for _, i := range intermediates {
+		opts.Intermediates.AddCert(i.Certificate)
+	}
+
+	chains, err := c.Certificate.Verify(opts)
+	if err != nil {
+		var invalidErr x509.CertificateInvalidError
+		var authorityErr x509.UnknownAuthorityError
+		switch {
+		case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+			// x509 reports certificates outside their validity period as expired,
+			// including issuers that are not yet valid.
+			if err := checkValidity(invalidErr.Cert, at); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w, %s", ErrCertificateExpired, err.Error())
+		case errors.As(err, &authorityErr):
+			return nil, fmt.Errorf("%w, %s", ErrCertificateUntrusted, err.Error())
+		}
+		return nil, fmt.Errorf("%w, %s", ErrCertificateInvalid, err.Error())
+	}
+
+	var nsErr error
+	for _, chain := range chains {
+		verified := []*Certificate{c}
+		for _, issuer := range chain[1:] {
+			bfIssuer, err := NewCertificate(issuer)
+			if err != nil {
+				nsErr = err
+				break
+			}
+			if bfIssuer.Namespace != c.Namespace {
+				nsErr = fmt.Errorf("%w, issuer namespace %s does not match %s",
+					ErrCertificateInvalid, bfIssuer.Namespace, c.Namespace)
+				break
+			}
+			verified = append(verified, bfIssuer)
+		}
+		if len(verified) == len(chain) {
+			return verified, nil
+		}
+	}
+	return nil, nsErr
+}
+
 // ToTLSCertificate returns a tls.Certificate from a bifrost certificate and private key.
 func (c Certificate) ToTLSCertificate(key PrivateKey) (*tls.Certificate, error) {
 	if key.PrivateKey == nil {
@@ -134,13 +284,101 @@ func (c Certificate) ToTLSCertificate(key PrivateKey) (*tls.Certificate, error)
 		Certificate: [][]byte{
 			c.Raw,
 		},
-		PrivateKey: key,
+		PrivateKey: key.PrivateKey,
 		Leaf:       c.Certificate,
 	}, nil
 }
 
+// MarshalBinary returns the ASN.1 DER form of the certificate.
+// Certificates issued to legacy RSA keys cannot be marshaled, because unmarshaling
+// rejects them. Use the Raw field and [ParseCertificate] with [AllowLegacyRSA] instead.
+// The other marshalers share this limitation.
+func (c Certificate) MarshalBinary() ([]byte, error) {
+	if c.Certificate == nil {
+		return nil, errors.New("bifrost: certificate is nil")
+	}
+	if c.PublicKey != nil && c.PublicKey.Type() == KeyTypeRSA {
+		return nil, fmt.Errorf("%w, cannot marshal certificate", errLegacyRSA)
+	}
+	return c.Raw, nil
+}
+
+// UnmarshalBinary parses and validates a certificate in ASN.1 DER form.
+// Certificates issued to legacy RSA keys are rejected,
+// use [ParseCertificate] with [AllowLegacyRSA] to accept them.
+func (c *Certificate) UnmarshalBinary(data []byte) error {
+	cert, err := ParseCertificate(data)
+	if err != nil {
+		return err
+	}
+	*c = *cert
+	return nil
+}
+
+// MarshalText marshals the certificate to a PEM encoded ASN.1 DER form.
+func (c Certificate) MarshalText() ([]byte, error) {
+	certDer, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	block := &pem.Block{
+		Type:  pemTypeCertificate,
+		Bytes: certDer,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// UnmarshalText unmarshals and validates a certificate from a PEM encoded ASN.1 DER form.
+func (c *Certificate) UnmarshalText(text []byte) error {
+	block, _ := pem.Decode(text)
+	if block == nil || block.Type != pemTypeCertificate {
+		return errors.New("bifrost: invalid certificate PEM block")
+	}
+	return c.UnmarshalBinary(block.Bytes)
+}
+
+// MarshalJSON marshals the certificate to a JSON string containing PEM encoded ASN.1 DER form.
+func (c Certificate) MarshalJSON() ([]byte, error) {
+	certText, err := c.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(certText))
+}
+
+// UnmarshalJSON unmarshals and validates a certificate from a JSON string
+// containing PEM encoded ASN.1 DER form.
+func (c *Certificate) UnmarshalJSON(data []byte) error {
+	var certString string
+	if err := json.Unmarshal(data, &certString); err != nil {
+		return err
+	}
+	return c.UnmarshalText([]byte(certString))
+}
+
+// MarshalDynamoDBAttributeValue marshals the certificate to ASN.1 DER form.
+func (c Certificate) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	certDer, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return attributevalue.Marshal(certDer)
+}
+
+// UnmarshalDynamoDBAttributeValue unmarshals and validates a certificate from ASN.1 DER form.
+func (c *Certificate) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var certDer []byte
+	if err := attributevalue.Unmarshal(av, &certDer); err != nil {
+		return err
+	}
+	return c.UnmarshalBinary(certDer)
+}
+
 // CertificateRequest is a bifrost certificate request.
 // It embeds the x509 certificate request and adds the bifrost ID, namespace, and public key.
+// CertificateRequest implements the Marshaler and Unmarshaler interfaces for binary, text,
+// JSON, and DynamoDB.
+// Certificate requests are serialised in ASN.1 DER form and validated when unmarshaled.
 type CertificateRequest struct {
 	*x509.CertificateRequest
 
@@ -151,20 +389,29 @@ type CertificateRequest struct {
 
 // ParseCertificateRequest parses a DER encoded certificate request and validates it.
 // On success, it returns the bifrost namespace, certificate request, and certificate public key.
-func ParseCertificateRequest(asn1Data []byte) (*CertificateRequest, error) {
+func ParseCertificateRequest(
+	asn1Data []byte,
+	opts ...ParseOption,
+) (*CertificateRequest, error) {
 	csr, err := x509.ParseCertificateRequest(asn1Data)
 	if err != nil {
 		return nil, fmt.Errorf("%w, %s", ErrRequestInvalid, err.Error())
 	}
-	return NewCertificateRequest(csr)
+	return NewCertificateRequest(csr, opts...)
 }
 
 // NewCertificateRequest creates a bifrost certificate request from an x509 certificate request.
 // It checks for the correct signature algorithm, identity namespace, and identity.
 // On success, it sets the ID, Namespace, and PublicKey fields.
-func NewCertificateRequest(cert *x509.CertificateRequest) (*CertificateRequest, error) {
+func NewCertificateRequest(
+	cert *x509.CertificateRequest,
+	opts ...ParseOption,
+) (*CertificateRequest, error) {
+	o := newParseOptions(opts)
+
 	// Check for bifrost signature algorithm
-	if cert.SignatureAlgorithm != SignatureAlgorithm {
+	if !isSignatureAlgorithmSupported(cert.SignatureAlgorithm) &&
+		!(o.allowRSA && isRSASignatureAlgorithm(cert.SignatureAlgorithm)) {
 		return nil, fmt.Errorf(
 			"%w, unsupported signature algorithm '%s'",
 			ErrRequestInvalid,
@@ -190,17 +437,21 @@ func NewCertificateRequest(cert *x509.CertificateRequest) (*CertificateRequest,
 		)
 	}
 
-	pubkey, ok := cert.PublicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf(
-			"%w, invalid public key type: '%T'",
-			ErrRequestInvalid,
-			cert.PublicKey,
-		)
+	if err := o.checkKey(cert.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrRequestInvalid, err)
 	}
 
 	pk := &PublicKey{
-		PublicKey: pubkey,
+		PublicKey: cert.PublicKey,
+	}
+
+	// Certificate requests are self-signed, the signature algorithm must match the key.
+	if !signatureAlgorithmMatchesKey(cert.SignatureAlgorithm, pk) {
+		return nil, fmt.Errorf(
+			"%w, signature algorithm '%s' does not match public key type",
+			ErrRequestInvalid,
+			cert.SignatureAlgorithm,
+		)
 	}
 
 	// Check if calculated UUID matches the UUID in the certificate
@@ -224,8 +475,88 @@ func NewCertificateRequest(cert *x509.CertificateRequest) (*CertificateRequest,
 	return bfReq, nil
 }
 
+// MarshalBinary returns the ASN.1 DER form of the certificate request.
+func (c CertificateRequest) MarshalBinary() ([]byte, error) {
+	if c.CertificateRequest == nil {
+		return nil, errors.New("bifrost: certificate request is nil")
+	}
+	return c.Raw, nil
+}
+
+// UnmarshalBinary parses and validates a certificate request in ASN.1 DER form.
+func (c *CertificateRequest) UnmarshalBinary(data []byte) error {
+	csr, err := ParseCertificateRequest(data)
+	if err != nil {
+		return err
+	}
+	*c = *csr
+	return nil
+}
+
+// MarshalText marshals the certificate request to a PEM encoded ASN.1 DER form.
+func (c CertificateRequest) MarshalText() ([]byte, error) {
+	csrDer, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	block := &pem.Block{
+		Type:  pemTypeCertificateRequest,
+		Bytes: csrDer,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// UnmarshalText unmarshals and validates a certificate request
+// from a PEM encoded ASN.1 DER form.
+func (c *CertificateRequest) UnmarshalText(text []byte) error {
+	block, _ := pem.Decode(text)
+	if block == nil || block.Type != pemTypeCertificateRequest {
+		return errors.New("bifrost: invalid certificate request PEM block")
+	}
+	return c.UnmarshalBinary(block.Bytes)
+}
+
+// MarshalJSON marshals the certificate request to a JSON string
+// containing PEM encoded ASN.1 DER form.
+func (c CertificateRequest) MarshalJSON() ([]byte, error) {
+	csrText, err := c.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(csrText))
+}
+
+// UnmarshalJSON unmarshals and validates a certificate request from a JSON string
+// containing PEM encoded ASN.1 DER form.
+func (c *CertificateRequest) UnmarshalJSON(data []byte) error {
+	var csrString string
+	if err := json.Unmarshal(data, &csrString); err != nil {
+		return err
+	}
+	return c.UnmarshalText([]byte(csrString))
+}
+
+// MarshalDynamoDBAttributeValue marshals the certificate request to ASN.1 DER form.
+func (c CertificateRequest) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	csrDer, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return attributevalue.Marshal(csrDer)
+}
+
+// UnmarshalDynamoDBAttributeValue unmarshals and validates a certificate request
+// from ASN.1 DER form.
+func (c *CertificateRequest) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var csrDer []byte
+	if err := attributevalue.Unmarshal(av, &csrDer); err != nil {
+		return err
+	}
+	return c.UnmarshalBinary(csrDer)
+}
+
 // X509ToTLSCertificate puts an x509.Certificate inside a tls.Certificate.
-func X509ToTLSCertificate(cert *x509.Certificate, key *ecdsa.PrivateKey) *tls.Certificate {
+func X509ToTLSCertificate(cert *x509.Certificate, key crypto.PrivateKey) *tls.Certificate {
 	return &tls.Certificate{
 		Certificate: [][]byte{
 			cert.Raw,
@@ -234,3 +565,33 @@ func X509ToTLSCertificate(cert *x509.Certificate, key *ecdsa.PrivateKey) *tls.Ce
 		Leaf:       cert,
 	}
 }
+
+// isSignatureAlgorithmSupported returns true if alg can be used by bifrost keys.
+func isSignatureAlgorithmSupported(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.PureEd25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRSASignatureAlgorithm returns true if alg is an RSA signature algorithm
+// accepted from legacy clients.
+func isRSASignatureAlgorithm(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return true
+	default:
+		return false
+	}
+}
+
+// signatureAlgorithmMatchesKey returns true if alg can be used to sign with key.
+func signatureAlgorithmMatchesKey(alg x509.SignatureAlgorithm, key *PublicKey) bool {
+	if key.Type() == KeyTypeRSA {
+		return isRSASignatureAlgorithm(alg)
+	}
+	return alg == key.SignatureAlgorithm()
+}
@@ -1,14 +1,22 @@
 package bifrost
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/google/uuid"
 )
 
@@ -137,3 +145,406 @@ func testNewCert(t *testing.T, tc *certVerifyTestCase) {
 		t.Fatalf("ValidateCertificate(%s) key = %v\nwant %v", tc.certPem, key, tc.wantKey)
 	}
 }
+
+func TestNewCertificateRequest_legacyRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, MinimumRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	pub := &PublicKey{PublicKey: &key.PublicKey}
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, want := pub.UUID(ns), uuid.NewSHA1(ns, append([]byte("RSA"), spki...)); id != want {
+		t.Fatalf("got UUID %s, want %s", id, want)
+	}
+
+	template := CertificateRequestTemplate(ns, pub)
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseCertificateRequest(der); !errors.Is(err, ErrRequestInvalid) {
+		t.Fatalf("expected ErrRequestInvalid without AllowLegacyRSA, got %v", err)
+	}
+
+	csr, err := ParseCertificateRequest(der, AllowLegacyRSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.ID != pub.UUID(ns) {
+		t.Fatalf("got ID %s, want %s", csr.ID, pub.UUID(ns))
+	}
+}
+
+func TestCertificate_Marshalers(t *testing.T) {
+	block, _ := pem.Decode(newCertTestCases[0].certPem)
+	cert, err := ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, got *Certificate) {
+		t.Helper()
+		if !got.Certificate.Equal(cert.Certificate) || got.ID != cert.ID ||
+			got.Namespace != cert.Namespace || !got.PublicKey.Equal(cert.PublicKey) {
+			t.Fatalf("got %v, want %v", got, cert)
+		}
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		data, err := cert.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Certificate
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		data, err := cert.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Certificate
+		if err := got.UnmarshalText(data); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Certificate
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("dynamodb", func(t *testing.T) {
+		item, err := attributevalue.MarshalMap(struct{ Cert *Certificate }{cert})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct{ Cert Certificate }
+		if err := attributevalue.UnmarshalMap(item, &got); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got.Cert)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var got Certificate
+		if err := got.UnmarshalText(newCertTestCases[1].certPem); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := (Certificate{}).MarshalBinary(); err == nil {
+			t.Fatal("expected error marshaling empty certificate")
+		}
+	})
+}
+
+func TestCertificateRequest_Marshalers(t *testing.T) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	der, err := x509.CreateCertificateRequest(
+		rand.Reader,
+		CertificateRequestTemplate(ns, key.PublicKey()),
+		key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, got *CertificateRequest) {
+		t.Helper()
+		if !bytes.Equal(got.Raw, csr.Raw) || got.ID != csr.ID ||
+			got.Namespace != csr.Namespace || !got.PublicKey.Equal(csr.PublicKey) {
+			t.Fatalf("got %v, want %v", got, csr)
+		}
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		data, err := csr.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CertificateRequest
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		data, err := csr.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CertificateRequest
+		if err := got.UnmarshalText(data); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(csr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CertificateRequest
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("dynamodb", func(t *testing.T) {
+		av, err := csr.MarshalDynamoDBAttributeValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CertificateRequest
+		if err := got.UnmarshalDynamoDBAttributeValue(av); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &got)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		// A certificate is not a certificate request.
+		var got CertificateRequest
+		if err := got.UnmarshalText(newCertTestCases[0].certPem); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestCertificate_Verify_namespace(t *testing.T) {
+	now := time.Now()
+	newCert := func(ns uuid.UUID, key, parentKey *PrivateKey, parent *x509.Certificate) *Certificate {
+		t.Helper()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(now.UnixNano()),
+			Subject: pkix.Name{
+				Organization: []string{ns.String()},
+				CommonName:   key.UUID(ns).String(),
+			},
+			NotBefore:             now.Add(-time.Minute),
+			NotAfter:              now.Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  parent == nil,
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	rootKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := newCert(uuid.New(), rootKey, nil, nil)
+	leaf := newCert(uuid.New(), leafKey, rootKey, root.Certificate)
+	if _, err := leaf.Verify([]*Certificate{root}, nil, now); !errors.Is(err, ErrCertificateInvalid) {
+		t.Fatalf("expected ErrCertificateInvalid for namespace mismatch, got %v", err)
+	}
+
+	leaf = newCert(root.Namespace, leafKey, rootKey, root.Certificate)
+	if _, err := leaf.Verify([]*Certificate{root}, nil, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificate_Verify_validity(t *testing.T) {
+	now := time.Now()
+	ns := uuid.New()
+	newCert := func(
+		key, parentKey *PrivateKey,
+		parent *x509.Certificate,
+		notBefore, notAfter time.Time,
+	) *Certificate {
+		t.Helper()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(now.UnixNano()),
+			Subject: pkix.Name{
+				Organization: []string{ns.String()},
+				CommonName:   key.UUID(ns).String(),
+			},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  parent == nil,
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	rootKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root is valid for an hour from now, the leaf for an hour around now.
+	root := newCert(rootKey, nil, nil, now, now.Add(time.Hour))
+	leaf := newCert(leafKey, rootKey, root.Certificate,
+		now.Add(-30*time.Minute), now.Add(30*time.Minute))
+
+	testCases := []struct {
+		name string
+		at   time.Time
+		err  error
+	}{
+		{"valid", now.Add(time.Minute), nil},
+		{"leaf expired", now.Add(45 * time.Minute), ErrCertificateExpired},
+		{"leaf not yet valid", now.Add(-45 * time.Minute), ErrCertificateNotYetValid},
+		{"root not yet valid", now.Add(-time.Minute), ErrCertificateNotYetValid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := leaf.Verify([]*Certificate{root}, nil, tc.at)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	// An expired root is reported as expired.
+	root = newCert(rootKey, nil, nil, now.Add(-time.Hour), now)
+	leaf = newCert(leafKey, rootKey, root.Certificate, now.Add(-time.Hour), now.Add(time.Hour))
+	_, err = leaf.Verify([]*Certificate{root}, nil, now.Add(time.Minute))
+	if !errors.Is(err, ErrCertificateExpired) {
+		t.Fatalf("expected ErrCertificateExpired, got %v", err)
+	}
+}
+
+func TestCertificate_Marshalers_legacyRSA(t *testing.T) {
+	cert := newLegacyRSACert(t)
+
+	if _, err := cert.MarshalBinary(); !errors.Is(err, errLegacyRSA) {
+		t.Fatalf("MarshalBinary: expected errLegacyRSA, got %v", err)
+	}
+	if _, err := cert.MarshalText(); !errors.Is(err, errLegacyRSA) {
+		t.Fatalf("MarshalText: expected errLegacyRSA, got %v", err)
+	}
+	if _, err := json.Marshal(cert); !errors.Is(err, errLegacyRSA) {
+		t.Fatalf("MarshalJSON: expected errLegacyRSA, got %v", err)
+	}
+	if _, err := cert.MarshalDynamoDBAttributeValue(); !errors.Is(err, errLegacyRSA) {
+		t.Fatalf("MarshalDynamoDBAttributeValue: expected errLegacyRSA, got %v", err)
+	}
+
+	// The raw certificate can still be parsed with AllowLegacyRSA.
+	var c Certificate
+	if err := c.UnmarshalBinary(cert.Raw); err == nil {
+		t.Fatal("expected UnmarshalBinary to reject a legacy RSA certificate")
+	}
+	if _, err := ParseCertificate(cert.Raw, AllowLegacyRSA()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newLegacyRSACert returns a bifrost certificate issued to a new RSA key,
+// signed by a new P-256 CA.
+func newLegacyRSACert(t *testing.T) *Certificate {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, MinimumRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{ns.String()},
+			CommonName:   caKey.UUID(ns).String(),
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	pub := &PublicKey{PublicKey: &rsaKey.PublicKey}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			Organization: []string{ns.String()},
+			CommonName:   pub.UUID(ns).String(),
+		},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &rsaKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(der, AllowLegacyRSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
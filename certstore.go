@@ -0,0 +1,130 @@
+package bifrost
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CertificateStore persists client certificates, so that clients can reuse a
+// still valid certificate after they restart instead of requesting a new one.
+type CertificateStore interface {
+	// LoadCertificate returns the stored certificate chain issued to key,
+	// the client certificate first.
+	// Chains are looked up by key alone, so that clients can load them without
+	// knowing the namespace of the CA.
+	// It returns an error wrapping fs.ErrNotExist if there is no stored chain.
+	LoadCertificate(ctx context.Context, key *PublicKey) ([]*Certificate, error)
+
+	// StoreCertificate stores a certificate chain, the client certificate first,
+	// replacing any chain stored for the same key.
+	StoreCertificate(ctx context.Context, chain []*Certificate) error
+}
+
+// CertificateDir is a [CertificateStore] that keeps certificate chains in a directory,
+// in PEM files named after the SHA-256 hash of the client certificate's public key.
+// Files are replaced atomically, so readers never see a partially written chain.
+type CertificateDir string
+
+// LoadCertificate implements [CertificateStore].
+func (d CertificateDir) LoadCertificate(ctx context.Context, key *PublicKey) ([]*Certificate, error) {
+	name, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("bifrost: error reading certificate: %w", err)
+	}
+
+	// The chain is looked up by key, so it may be issued to a legacy RSA key
+	// only if the client uses one.
+	var opts []ParseOption
+	if key.Type() == KeyTypeRSA {
+		opts = append(opts, AllowLegacyRSA())
+	}
+	var chain []*Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != pemTypeCertificate {
+			continue
+		}
+		cert, err := ParseCertificate(block.Bytes, opts...)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("bifrost: no certificate in file")
+	}
+	if !chain[0].IssuedTo(key) {
+		return nil, fmt.Errorf("%w, stored certificate does not match key", ErrCertificateInvalid)
+	}
+	return chain, nil
+}
+
+// StoreCertificate implements [CertificateStore].
+// The directory is created if it does not exist.
+func (d CertificateDir) StoreCertificate(ctx context.Context, chain []*Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("bifrost: no certificate to store")
+	}
+
+	// Encode raw certificates, which unlike MarshalText include those issued
+	// to legacy RSA keys.
+	var buf bytes.Buffer
+	for _, c := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: pemTypeCertificate, Bytes: c.Raw}); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(string(d), 0o700); err != nil {
+		return fmt.Errorf("bifrost: error creating certificate directory: %w", err)
+	}
+
+	// Write to a temporary file in the same directory and rename it into place.
+	name, err := d.path(chain[0].PublicKey)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(string(d), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("bifrost: error creating certificate file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("bifrost: error writing certificate file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("bifrost: error writing certificate file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("bifrost: error writing certificate file: %w", err)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return fmt.Errorf("bifrost: error writing certificate file: %w", err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("bifrost: error writing certificate file: %w", err)
+	}
+	return nil
+}
+
+func (d CertificateDir) path(key *PublicKey) (string, error) {
+	der, err := key.MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("bifrost: error marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return filepath.Join(string(d), hex.EncodeToString(sum[:])+".pem"), nil
+}
@@ -0,0 +1,156 @@
+package bifrost
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCertificateDir(t *testing.T) {
+	ca := newTestCAServer(t, time.Hour)
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := RequestCertificateChain(context.Background(), ca.URL, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := chain[0]
+
+	dir := CertificateDir(filepath.Join(t.TempDir(), "certs"))
+	ctx := context.Background()
+	if _, err := dir.LoadCertificate(ctx, key.PublicKey()); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if err := dir.StoreCertificate(ctx, chain); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dir.LoadCertificate(ctx, key.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Equal(leaf.Certificate) {
+		t.Fatal("loaded certificate does not match stored certificate")
+	}
+
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := dir.path(key.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(name) {
+		t.Fatalf("expected only the certificate file, got %v", entries)
+	}
+
+	// Certificates issued to another key are rejected.
+	other, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherName, err := dir.path(other.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(name, otherName); err != nil {
+		t.Fatal(err)
+	}
+	_, err = dir.LoadCertificate(ctx, other.PublicKey())
+	if !errors.Is(err, ErrCertificateInvalid) {
+		t.Fatalf("expected ErrCertificateInvalid, got %v", err)
+	}
+}
+
+func TestCertificateDir_legacyRSA(t *testing.T) {
+	cert := newLegacyRSACert(t)
+	dir := CertificateDir(t.TempDir())
+	ctx := context.Background()
+	if err := dir.StoreCertificate(ctx, []*Certificate{cert}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dir.LoadCertificate(ctx, cert.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Equal(cert.Certificate) {
+		t.Fatal("loaded certificate does not match stored certificate")
+	}
+}
+
+func TestCertRefresher_store(t *testing.T) {
+	ca := newTestCAServer(t, time.Hour)
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := CertificateDir(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := NewHTTPClient(ctx, ca.URL, key, WithCertificateStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ca.issued.Load(); n != 1 {
+		t.Fatalf("got %d certificates issued, want 1", n)
+	}
+
+	// A restarted client reuses the stored certificate without contacting the CA.
+	requests := ca.requests.Load()
+	second, err := NewHTTPClient(ctx, ca.URL, key, WithCertificateStore(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ca.requests.Load() - requests; n != 0 {
+		t.Fatalf("got %d requests to the CA, want 0", n)
+	}
+	clientCert := func(c *http.Client) *tls.Certificate {
+		t.Helper()
+		cert, err := c.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	if !bytes.Equal(clientCert(first).Certificate[0], clientCert(second).Certificate[0]) {
+		t.Fatal("expected the stored certificate")
+	}
+
+	// A different key gets its own certificate.
+	other, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHTTPClient(ctx, ca.URL, other, WithCertificateStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if n := ca.issued.Load(); n != 2 {
+		t.Fatalf("got %d certificates issued, want 2", n)
+	}
+
+	// Clients with a valid stored certificate start while the CA is down.
+	ca.Close()
+	if _, err := NewHTTPClient(ctx, ca.URL, key, WithCertificateStore(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored certificates from another namespace are ignored.
+	otherNS := uuid.MustParse("01881c8c-e2e1-4950-9dee-3a9558c6c741")
+	_, err = NewHTTPClient(ctx, ca.URL, key, WithCertificateStore(dir), WithNamespace(otherNS))
+	if err == nil {
+		t.Fatal("expected an error requesting a certificate from a stopped CA")
+	}
+}
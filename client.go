@@ -6,82 +6,206 @@ import (
 	"crypto/x509"
 	"io"
 	"net/http"
-	"sync/atomic"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // HTTPClient returns a http.Client set up for TLS Client Authentication (mTLS).
 // The client will request a new certificate from the bifrost caUrl when needed.
 // If roots is not nil, then only those Root CAs are used to authenticate server certs.
 // If ssllog is not nil, the client will log TLS key material to it.
+//
+// The client does not renew certificates in the background, so it holds no resources
+// once it is no longer used. Certificates are renewed when a TLS handshake finds them
+// close to expiry.
+// Use [NewHTTPClient] for background renewal, and to configure the transport, timeouts,
+// and CA requests.
 func HTTPClient(
 	caUrl string,
 	privkey *PrivateKey,
 	roots *x509.CertPool,
 	ssllog io.Writer,
 ) (*http.Client, error) {
-	cr := &certRefresher{
-		url:     caUrl,
-		privkey: privkey,
+	o := newClientOptions(caUrl, []ClientOption{WithRootCAs(roots), WithKeyLogWriter(ssllog)})
+	return o.httpClient(context.Background(), privkey)
+}
+
+// ClientOption configures clients returned by [NewHTTPClient] and [TransportCredentials].
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	transport *http.Transport
+	roots     *x509.CertPool
+	keyLog    io.Writer
+	timeout   time.Duration
+	ca        CAClient
+	renewal   renewalOptions
+}
+
+// WithTransport sets the base transport of the client.
+// The transport is cloned and its TLS client config is set up for mTLS,
+// keeping other TLS settings. Defaults to a clone of http.DefaultTransport.
+func WithTransport(t *http.Transport) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = t
 	}
-	if _, err := cr.getClientCertificate(nil); err != nil {
-		return nil, err
+}
+
+// WithRootCAs sets the Root CAs used to authenticate server certs.
+// If roots is nil, the system roots are used.
+func WithRootCAs(roots *x509.CertPool) ClientOption {
+	return func(o *clientOptions) {
+		o.roots = roots
 	}
+}
 
-	tlsConfig := &tls.Config{
-		GetClientCertificate: cr.getClientCertificate,
-		RootCAs:              roots,
-		KeyLogWriter:         ssllog,
+// WithKeyLogWriter sets a writer for TLS key material, for use with tools like Wireshark.
+func WithKeyLogWriter(w io.Writer) ClientOption {
+	return func(o *clientOptions) {
+		o.keyLog = w
 	}
+}
 
-	tlsTransport := http.DefaultTransport.(*http.Transport).Clone()
-	tlsTransport.TLSClientConfig = tlsConfig
+// WithTimeout sets the time limit for requests made by the client.
+// A timeout of zero means no timeout.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
 
-	return &http.Client{
-		Transport: tlsTransport,
-	}, nil
+// WithCAClient sets the client used for requests to the bifrost CA.
+// CA requests do not use the mTLS transport, so set this to configure proxies,
+// TLS roots, or timeouts for the CA. Defaults to http.DefaultClient.
+func WithCAClient(c *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.ca.HTTPClient = c
+	}
+}
+
+// WithRetry sets the policy for retrying certificate requests to the bifrost CA.
+// By default requests are not retried.
+func WithRetry(p RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.ca.Retry = p
+	}
+}
+
+// WithNamespace sets the namespace of the bifrost CA, so that clients do not need
+// to ask the CA for it.
+func WithNamespace(ns uuid.UUID) ClientOption {
+	return func(o *clientOptions) {
+		o.ca.Namespace = ns
+	}
+}
+
+// WithCertificateStore sets a store for client certificates.
+// Issued certificates are saved to the store, and a stored certificate that is
+// still valid for the private key is used instead of requesting a new one when the
+// client starts, without contacting the CA.
+// If a namespace is set with [WithNamespace], stored certificates from other namespaces
+// are ignored.
+// Use [CertificateDir] to store certificates in a directory, for example next to the key.
+func WithCertificateStore(s CertificateStore) ClientOption {
+	return func(o *clientOptions) {
+		o.renewal.store = s
+	}
 }
 
-type certRefresher struct {
-	url     string
-	privkey *PrivateKey
-	cert    atomic.Pointer[Certificate]
+// WithRenewalWindow sets when client certificates are renewed, as the fraction of the
+// certificate lifetime remaining. For example, 0.5 renews certificates halfway through
+// their lifetime. Defaults to DefaultRenewalWindow.
+func WithRenewalWindow(fraction float64) ClientOption {
+	return func(o *clientOptions) {
+		o.renewal.window = fraction
+	}
 }
 
-func (cr *certRefresher) getClientCertificate(
-	info *tls.CertificateRequestInfo,
-) (*tls.Certificate, error) {
-	ctx := context.Background()
-	if info != nil {
-		ctx = info.Context()
+// OnRenew sets a function called with the certificate chain every time a client
+// certificate is issued, including the first one.
+func OnRenew(fn func(chain []*Certificate)) ClientOption {
+	return func(o *clientOptions) {
+		o.renewal.onRenew = fn
 	}
+}
 
-	// If we don't have a certificate or it's about to expire, request a new one.
-	if cert := cr.cert.Load(); cert == nil || time.Until(cert.NotAfter) < 10*time.Minute {
-		Logger().DebugContext(ctx, "refreshing client certificate")
+// OnError sets a function called when requesting a client certificate fails.
+// Clients keep using the current certificate until it expires, and retry the request.
+func OnError(fn func(err error)) ClientOption {
+	return func(o *clientOptions) {
+		o.renewal.onError = fn
+	}
+}
 
-		cert, err := RequestCertificate(ctx, cr.url, cr.privkey)
-		if err != nil {
-			return nil, err
-		}
+// NewHTTPClient returns a http.Client set up for TLS Client Authentication (mTLS).
+// The client requests a certificate from the bifrost caUrl, and renews it in the background
+// before it expires.
+//
+// Background renewal runs until ctx is done, so cancel ctx when the client is no longer
+// needed. After that, certificates are renewed when a TLS handshake finds them close to expiry.
+// ctx also bounds the request for the first certificate.
+func NewHTTPClient(
+	ctx context.Context,
+	caUrl string,
+	privkey *PrivateKey,
+	opts ...ClientOption,
+) (*http.Client, error) {
+	o := newClientOptions(caUrl, opts)
+	o.renewal.background = true
+	return o.httpClient(ctx, privkey)
+}
 
-		for {
-			oldCert := cr.cert.Load()
-			if cr.cert.CompareAndSwap(oldCert, cert) {
-				break
-			}
-		}
-		Logger().InfoContext(ctx, "got new client certificate",
-			"namespace", cert.Namespace, "uuid", cert.ID)
+func (o *clientOptions) httpClient(ctx context.Context, privkey *PrivateKey) (*http.Client, error) {
+	tlsConfig, err := o.tlsConfig(ctx, privkey)
+	if err != nil {
+		return nil, err
 	}
 
-	tlsCert := X509ToTLSCertificate(cr.cert.Load().Certificate, cr.privkey.PrivateKey)
+	var tlsTransport *http.Transport
+	if o.transport != nil {
+		tlsTransport = o.transport.Clone()
+	} else {
+		tlsTransport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	tlsTransport.TLSClientConfig = tlsConfig
 
-	if info != nil {
-		if err := info.SupportsCertificate(tlsCert); err != nil {
-			return nil, err
-		}
+	return &http.Client{
+		Transport: tlsTransport,
+		Timeout:   o.timeout,
+	}, nil
+}
+
+func newClientOptions(caUrl string, opts []ClientOption) *clientOptions {
+	o := &clientOptions{ca: CAClient{URL: caUrl}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// tlsConfig returns a tls.Config that gets client certificates from the bifrost CA.
+// It requests the first certificate immediately, so that errors surface early.
+// Background renewal, if enabled, runs until ctx is done.
+func (o *clientOptions) tlsConfig(ctx context.Context, privkey *PrivateKey) (*tls.Config, error) {
+	ca := o.ca
+	cr := newCertRefresher(ctx, &ca, privkey, o.renewal)
+	if _, err := cr.clientCertificate(ctx); err != nil {
+		return nil, err
 	}
 
-	return tlsCert, nil
+	var tlsConfig *tls.Config
+	if o.transport != nil && o.transport.TLSClientConfig != nil {
+		tlsConfig = o.transport.TLSClientConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.GetClientCertificate = cr.getClientCertificate
+	if o.roots != nil {
+		tlsConfig.RootCAs = o.roots
+	}
+	if o.keyLog != nil {
+		tlsConfig.KeyLogWriter = o.keyLog
+	}
+	return tlsConfig, nil
 }
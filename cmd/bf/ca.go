@@ -17,6 +17,7 @@ import (
 	"github.com/RealImage/bifrost/cafiles"
 	"github.com/RealImage/bifrost/internal/webapp"
 	"github.com/RealImage/bifrost/tinyca"
+	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/urfave/cli/v3"
 )
 
@@ -33,6 +34,7 @@ var (
 	enableCORS     bool
 	exposeMetrics  bool
 	gauntletPlugin string
+	lambdaMode     bool
 )
 
 var caServeCmd = &cli.Command{
@@ -42,6 +44,11 @@ var caServeCmd = &cli.Command{
 	Flags: []cli.Flag{
 		caCertFlag,
 		caPrivKeyFlag,
+		kmsEndpointFlag,
+		passphraseFileFlag,
+		allowRSAFlag,
+		spiffeFlag,
+		uuidURNFlag,
 		&cli.StringFlag{
 			Name:        "host",
 			Usage:       "listen on `HOST`",
@@ -78,13 +85,21 @@ var caServeCmd = &cli.Command{
 			Value:       false,
 			Destination: &exposeMetrics,
 		},
+		&cli.BoolFlag{
+			Name:        "lambda",
+			Usage:       "handle AWS Lambda proxy events instead of listening on HOST:PORT",
+			Sources:     cli.EnvVars("LAMBDA"),
+			Value:       false,
+			Destination: &lambdaMode,
+		},
 	},
 	Action: func(ctx context.Context, _ *cli.Command) error {
-		cert, key, err := cafiles.GetCertKey(ctx, caCertUri, caPrivKeyUri)
+		chain, key, err := cafiles.GetCertChainSigner(ctx, caCertUri, caPrivKeyUri, keyOptions()...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error reading cert/key", "error", err)
 			return cli.Exit("Error reading cert/key", 1)
 		}
+		cert := chain[0]
 		bifrost.Logger().DebugContext(
 			ctx, "loaded CA certificate and private key",
 			"subject", cert.Subject,
@@ -98,7 +113,7 @@ var caServeCmd = &cli.Command{
 			return cli.Exit("Error loading interceptor plugin", 1)
 		}
 
-		ca, err := tinyca.New(cert, key, gauntlet)
+		ca, err := tinyca.New(cert, key, gauntlet, caOptions(chain[1:]...)...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error creating CA", "error", err)
 			return cli.Exit("Error creating CA", 1)
@@ -114,6 +129,12 @@ var caServeCmd = &cli.Command{
 			hdlr = corsMiddleware(hdlr)
 		}
 
+		if lambdaMode {
+			bifrost.Logger().InfoContext(ctx, "starting lambda handler", "namespace", cert.Namespace)
+			lambda.StartWithOptions(tinyca.LambdaHandler(hdlr), lambda.WithContext(ctx))
+			return nil
+		}
+
 		addr := fmt.Sprintf("%s:%d", caHost, caPort)
 		bifrost.Logger().
 			InfoContext(ctx, "starting server", "address", addr, "namespace", cert.Namespace)
@@ -166,27 +187,33 @@ var caIssueCmd = &cli.Command{
 	Flags: []cli.Flag{
 		caCertFlag,
 		caPrivKeyFlag,
+		kmsEndpointFlag,
 		clientPrivKeyFlag,
+		passphraseFileFlag,
+		allowRSAFlag,
+		spiffeFlag,
+		uuidURNFlag,
 		notBeforeFlag,
 		notAfterFlag,
 		outputFlag,
 	},
 
 	Action: func(ctx context.Context, _ *cli.Command) error {
-		caCert, caKey, err := cafiles.GetCertKey(ctx, caCertUri, caPrivKeyUri)
+		chain, caKey, err := cafiles.GetCertChainSigner(ctx, caCertUri, caPrivKeyUri, keyOptions()...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error reading cert/key", "error", err)
 			return cli.Exit("Error reading cert/key", 1)
 		}
+		caCert := chain[0]
 
-		ca, err := tinyca.New(caCert, caKey, nil)
+		ca, err := tinyca.New(caCert, caKey, nil, caOptions(chain[1:]...)...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error creating CA", "error", err)
 			return cli.Exit("Error creating CA", 1)
 		}
 		defer ca.Stop()
 
-		clientKey, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri)
+		clientKey, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri, keyOptions()...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error reading client key", "error", err)
 			return cli.Exit("Error reading client key", 1)
@@ -230,11 +257,15 @@ var caIssueCmd = &cli.Command{
 			}
 		}()
 
-		block := &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: cert,
+		// Intermediate CA certificates follow the issued certificate.
+		if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
+			return err
 		}
-
-		return pem.Encode(out, block)
+		for _, c := range ca.Chain() {
+			if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+				return err
+			}
+		}
+		return nil
 	},
 }
@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 
+	"github.com/RealImage/bifrost"
+	"github.com/RealImage/bifrost/tinyca"
 	"github.com/google/uuid"
 	"github.com/urfave/cli/v3"
 )
@@ -45,6 +47,25 @@ var (
 		Destination: &caPrivKeyUri,
 	}
 
+	intermediatePrivKeyUri  string
+	intermediatePrivKeyFlag = &cli.StringFlag{
+		Name:        "intermediate-private-key",
+		Usage:       "read intermediate CA private key from `URI`",
+		Aliases:     []string{"intermediate-key"},
+		Sources:     cli.EnvVars("INTERMEDIATE_PRIVKEY", "INTERMEDIATE_KEY"),
+		TakesFile:   true,
+		Value:       "intermediatekey.pem",
+		Destination: &intermediatePrivKeyUri,
+	}
+
+	kmsEndpoint     string
+	kmsEndpointFlag = &cli.StringFlag{
+		Name:        "kms-endpoint",
+		Usage:       "send AWS KMS requests for the CA private key to `URL`",
+		Sources:     cli.EnvVars("KMS_ENDPOINT"),
+		Destination: &kmsEndpoint,
+	}
+
 	clientPrivKeyUri  string
 	clientPrivKeyFlag = &cli.StringFlag{
 		Name:        "client-private-key",
@@ -73,6 +94,32 @@ var (
 		Destination: &notAfterTime,
 	}
 
+	allowLegacyRSA bool
+	allowRSAFlag   = &cli.BoolFlag{
+		Name:        "allow-legacy-rsa",
+		Usage:       "accept legacy RSA client keys",
+		Aliases:     []string{"allow-rsa"},
+		Sources:     cli.EnvVars("ALLOW_LEGACY_RSA"),
+		Destination: &allowLegacyRSA,
+	}
+
+	spiffeTrustDomain string
+	spiffeFlag        = &cli.StringFlag{
+		Name:        "spiffe-trust-domain",
+		Usage:       "add SPIFFE IDs in trust domain `NAME` to issued certificates",
+		Aliases:     []string{"spiffe"},
+		Sources:     cli.EnvVars("SPIFFE_TRUST_DOMAIN"),
+		Destination: &spiffeTrustDomain,
+	}
+
+	addUUIDURN  bool
+	uuidURNFlag = &cli.BoolFlag{
+		Name:        "uuid-urn",
+		Usage:       "add urn:uuid URIs to issued certificates",
+		Sources:     cli.EnvVars("UUID_URN"),
+		Destination: &addUUIDURN,
+	}
+
 	outputFile string
 	outputFlag = &cli.StringFlag{
 		Name:        "output",
@@ -92,3 +139,22 @@ func getOutputWriter() (io.WriteCloser, func() error, error) {
 	f, err := os.Create(outputFile)
 	return f, f.Close, err
 }
+
+// caOptions returns tinyca options from flags.
+// issuers are the intermediate CA certificates following the CA certificate.
+func caOptions(issuers ...*bifrost.Certificate) []tinyca.Option {
+	var opts []tinyca.Option
+	if allowLegacyRSA {
+		opts = append(opts, tinyca.WithLegacyRSA())
+	}
+	if spiffeTrustDomain != "" {
+		opts = append(opts, tinyca.WithSPIFFEID(spiffeTrustDomain))
+	}
+	if addUUIDURN {
+		opts = append(opts, tinyca.WithUUIDURN())
+	}
+	if len(issuers) > 0 {
+		opts = append(opts, tinyca.WithChain(issuers...))
+	}
+	return opts
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,12 +12,24 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
+var idFormat string
+
 var idCmd = &cli.Command{
 	Name:    "identity",
 	Aliases: []string{"id"},
-	Usage:   "Parses a bifrost UUID from a pem file",
+	Usage:   "Parses bifrost UUIDs from pem, der, openssh, jwk, or jwks files",
 	Flags: []cli.Flag{
 		nsFlag,
+		passphraseFileFlag,
+		allowRSAFlag,
+		&cli.StringFlag{
+			Name:        "format",
+			Usage:       "output `FORMAT`, one of uuid or jwk",
+			Aliases:     []string{"f"},
+			Sources:     cli.EnvVars("ID_FORMAT"),
+			Value:       "uuid",
+			Destination: &idFormat,
+		},
 	},
 	Action: func(ctx context.Context, cmd *cli.Command) error {
 		filename := cmd.Args().First()
@@ -33,30 +46,79 @@ var idCmd = &cli.Command{
 			return err
 		}
 
-		id, err := bifrost.ParseIdentity(data)
+		var parseOpts []bifrost.ParseOption
+		if allowLegacyRSA {
+			parseOpts = append(parseOpts, bifrost.AllowLegacyRSA())
+		}
+		ids, err := bifrost.ParseIdentities(data, parseOpts...)
+		if len(ids) == 0 && errors.Is(err, bifrost.ErrPrivateKeyEncrypted) {
+			var id *bifrost.ParsedIdentity
+			id, err = parseEncryptedIdentity(ctx, filename, data)
+			ids = []*bifrost.ParsedIdentity{id}
+		}
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error parsing id file", "error", err)
 			return cli.Exit("Error parsing file", 1)
 		}
 
-		if id.Namespace == uuid.Nil && namespace == uuid.Nil {
-			return cli.Exit("Namespace is required", 1)
+		if idFormat != "uuid" && idFormat != "jwk" {
+			return cli.Exit(fmt.Sprintf("Unsupported format %q", idFormat), 1)
 		}
 
-		// Either we got a namespace from the file or the namespace flag is set
-		if id.Namespace != uuid.Nil && namespace != uuid.Nil && id.Namespace != namespace {
-			bifrost.Logger().
-				ErrorContext(ctx, "namespace mismatch", "file", id.Namespace, "flag", namespace)
-			return cli.Exit("Namespace mismatch", 1)
-		}
+		for _, id := range ids {
+			bifrost.Logger().DebugContext(ctx, "found identity", "format", id.Format, "type", id.Type)
 
-		if namespace != uuid.Nil {
-			id.Namespace = namespace
-		}
+			if idFormat == "jwk" {
+				// JWKs carry the public key, the namespace is not needed.
+				jwk, err := id.PublicKey.MarshalJWK()
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jwk))
+				continue
+			}
+
+			if id.Namespace == uuid.Nil && namespace == uuid.Nil {
+				return cli.Exit("Namespace is required", 1)
+			}
+
+			// Either we got a namespace from the file or the namespace flag is set
+			if id.Namespace != uuid.Nil && namespace != uuid.Nil && id.Namespace != namespace {
+				bifrost.Logger().
+					ErrorContext(ctx, "namespace mismatch", "file", id.Namespace, "flag", namespace)
+				return cli.Exit("Namespace mismatch", 1)
+			}
 
-		bifrost.Logger().Debug("using", "namespace", id.Namespace)
-		fmt.Println(id.UUID())
+			if namespace != uuid.Nil {
+				id.Namespace = namespace
+			}
+
+			bifrost.Logger().Debug("using", "namespace", id.Namespace)
+			fmt.Println(id.UUID())
+		}
 
 		return nil
 	},
 }
+
+func parseEncryptedIdentity(
+	ctx context.Context,
+	uri string,
+	data []byte,
+) (*bifrost.ParsedIdentity, error) {
+	passphrase, err := getPassphrase(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var key bifrost.PrivateKey
+	if err := key.UnmarshalEncryptedText(data, passphrase); err != nil {
+		return nil, err
+	}
+
+	return &bifrost.ParsedIdentity{
+		Identity: &bifrost.Identity{PublicKey: key.PublicKey()},
+		Format:   bifrost.FormatPEM,
+		Type:     "ENCRYPTED PRIVATE KEY",
+	}, nil
+}
@@ -15,6 +15,12 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
+var (
+	keyType    string
+	keyFormat  string
+	encryptKey bool
+)
+
 var newCmd = &cli.Command{
 	Name:    "new",
 	Aliases: []string{"n"},
@@ -49,18 +55,69 @@ var newCmd = &cli.Command{
 			Usage:   "Create a new identity",
 			Flags: []cli.Flag{
 				outputFlag,
+				&cli.StringFlag{
+					Name:        "type",
+					Usage:       "key `TYPE`, one of p256, p384, or ed25519",
+					Aliases:     []string{"t"},
+					Sources:     cli.EnvVars("KEY_TYPE"),
+					Value:       string(bifrost.KeyTypeP256),
+					Destination: &keyType,
+				},
+				&cli.StringFlag{
+					Name:        "format",
+					Usage:       "output `FORMAT`, one of pem or jwk",
+					Aliases:     []string{"f"},
+					Sources:     cli.EnvVars("KEY_FORMAT"),
+					Value:       "pem",
+					Destination: &keyFormat,
+				},
+				&cli.BoolFlag{
+					Name:        "encrypt",
+					Usage:       "encrypt the private key with a passphrase",
+					Aliases:     []string{"e"},
+					Sources:     cli.EnvVars("ENCRYPT_KEY"),
+					Destination: &encryptKey,
+				},
+				passphraseFileFlag,
 			},
 			Action: func(ctx context.Context, _ *cli.Command) error {
-				key, err := bifrost.NewPrivateKey()
+				kt, err := bifrost.ParseKeyType(keyType)
 				if err != nil {
 					return err
 				}
 
-				keyText, err := key.MarshalText()
+				key, err := bifrost.GeneratePrivateKey(kt)
 				if err != nil {
 					return err
 				}
 
+				var keyText []byte
+				switch {
+				case keyFormat == "jwk":
+					if encryptKey {
+						return fmt.Errorf("JWK private keys cannot be encrypted")
+					}
+					if keyText, err = key.MarshalJWK(); err != nil {
+						return err
+					}
+					keyText = append(keyText, '\n')
+				case keyFormat != "pem":
+					return fmt.Errorf("unsupported key format %q", keyFormat)
+				case encryptKey:
+					passphrase, err := getNewPassphrase(ctx)
+					if err != nil {
+						return err
+					}
+					keyText, err = key.MarshalEncryptedText(passphrase)
+					if err != nil {
+						return err
+					}
+				default:
+					if keyText, err = key.MarshalText(); err != nil {
+						return err
+					}
+				}
+
 				out, cls, err := getOutputWriter()
 				if err != nil {
 					return err
@@ -82,6 +139,7 @@ var newCmd = &cli.Command{
 			Flags: []cli.Flag{
 				nsFlag,
 				clientPrivKeyFlag,
+				passphraseFileFlag,
 				outputFlag,
 			},
 			Usage: "Create a new certificate request",
@@ -90,7 +148,7 @@ var newCmd = &cli.Command{
 					return fmt.Errorf("namespace is required")
 				}
 
-				key, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri)
+				key, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri, keyOptions()...)
 				if err != nil {
 					return err
 				}
@@ -130,6 +188,8 @@ var newCmd = &cli.Command{
 			Flags: []cli.Flag{
 				nsFlag,
 				caPrivKeyFlag,
+				kmsEndpointFlag,
+				passphraseFileFlag,
 				outputFlag,
 				notBeforeFlag,
 				notAfterFlag,
@@ -140,12 +200,13 @@ var newCmd = &cli.Command{
 					return fmt.Errorf("namespace is required")
 				}
 
-				key, err := cafiles.GetPrivateKey(ctx, caPrivKeyUri)
+				key, err := cafiles.GetSigner(ctx, caPrivKeyUri, keyOptions()...)
 				if err != nil {
 					return err
 				}
 
-				id := key.UUID(namespace)
+				pub := bifrost.PublicKey{PublicKey: key.Public()}
+				id := pub.UUID(namespace)
 				notBefore, notAfter, err := tinyca.ParseValidity(
 					notBeforeTime,
 					notAfterTime,
@@ -166,7 +227,7 @@ var newCmd = &cli.Command{
 					rand.Reader,
 					template,
 					template,
-					key.PublicKey().PublicKey,
+					pub.PublicKey,
 					key,
 				)
 				if err != nil {
@@ -193,5 +254,83 @@ var newCmd = &cli.Command{
 				return err
 			},
 		},
+		{
+			Name:    "intermediate-certificate",
+			Aliases: []string{"intermediate", "int"},
+			Flags: []cli.Flag{
+				caCertFlag,
+				caPrivKeyFlag,
+				intermediatePrivKeyFlag,
+				kmsEndpointFlag,
+				passphraseFileFlag,
+				outputFlag,
+				notBeforeFlag,
+				notAfterFlag,
+			},
+			Usage: "Create a new intermediate certificate authority signing certificate",
+			Action: func(ctx context.Context, _ *cli.Command) error {
+				chain, caKey, err := cafiles.GetCertChainSigner(
+					ctx,
+					caCertUri,
+					caPrivKeyUri,
+					keyOptions()...,
+				)
+				if err != nil {
+					return err
+				}
+
+				ca, err := tinyca.New(chain[0], caKey, nil, tinyca.WithChain(chain[1:]...))
+				if err != nil {
+					return err
+				}
+				defer ca.Stop()
+
+				key, err := cafiles.GetSigner(ctx, intermediatePrivKeyUri, keyOptions()...)
+				if err != nil {
+					return err
+				}
+
+				notBefore, notAfter, err := tinyca.ParseValidity(
+					notBeforeTime,
+					notAfterTime,
+					tinyca.MaximumCACertValidity,
+				)
+				if err != nil {
+					return err
+				}
+
+				certDer, err := ca.IssueIntermediateCertificate(
+					&bifrost.PublicKey{PublicKey: key.Public()},
+					notBefore,
+					notAfter,
+				)
+				if err != nil {
+					return err
+				}
+
+				out, cls, err := getOutputWriter()
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if err := cls(); err != nil {
+						bifrost.Logger().
+							ErrorContext(ctx, "error closing output writer", "error", err)
+					}
+				}()
+
+				// The intermediate certificate is followed by the chain to the root,
+				// so the output can be used as the CA certificate of a bifrost CA.
+				if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certDer}); err != nil {
+					return err
+				}
+				for _, c := range ca.Chain() {
+					if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
 	},
 }
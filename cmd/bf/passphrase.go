@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/RealImage/bifrost/cafiles"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+// passphraseEnvVar is the environment variable that holds a private key passphrase.
+const passphraseEnvVar = "KEY_PASSPHRASE"
+
+var (
+	passphraseFile     string
+	passphraseFileFlag = &cli.StringFlag{
+		Name:        "passphrase-file",
+		Usage:       "read private key passphrase from `FILE`",
+		Sources:     cli.EnvVars("PASSPHRASE_FILE"),
+		TakesFile:   true,
+		Destination: &passphraseFile,
+	}
+)
+
+// getPassphrase returns a private key passphrase from the passphrase file,
+// the KEY_PASSPHRASE environment variable, or by prompting on the terminal,
+// in that order.
+func getPassphrase(_ context.Context, uri string) ([]byte, error) {
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	}
+
+	if p, ok := os.LookupEnv(passphraseEnvVar); ok {
+		return []byte(p), nil
+	}
+
+	return readPassphrase(fmt.Sprintf("Enter passphrase for %s: ", uri))
+}
+
+// getNewPassphrase returns a passphrase to encrypt a new private key.
+// Passphrases read from the terminal must be entered twice.
+func getNewPassphrase(ctx context.Context) ([]byte, error) {
+	if passphraseFile != "" || os.Getenv(passphraseEnvVar) != "" {
+		return getPassphrase(ctx, "")
+	}
+
+	passphrase, err := readPassphrase("Enter new passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf(
+			"passphrase required, set %s or --passphrase-file",
+			passphraseEnvVar,
+		)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	passphrase, err := term.ReadPassword(fd)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	return passphrase, nil
+}
+
+func keyOptions() []cafiles.Option {
+	opts := []cafiles.Option{cafiles.WithPassphrase(getPassphrase)}
+	if kmsEndpoint != "" {
+		opts = append(opts, cafiles.WithKMSEndpoint(kmsEndpoint))
+	}
+	return opts
+}
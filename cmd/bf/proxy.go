@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -14,6 +16,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/RealImage/bifrost"
@@ -29,8 +32,28 @@ var (
 	proxyHost  string
 	proxyPort  int64
 	sslLogfile string
+	certHeader asgard.HeaderName
+
+	proxyHMACKeyFile string
+	proxySigningKey  string
+	policyFile       string
+	directoryFile    string
 )
 
+// policyReloadInterval is how often bf proxy checks the policy file for changes.
+const policyReloadInterval = 10 * time.Second
+
+// certHeaders maps --client-cert-header values to header formats.
+var certHeaders = map[string]asgard.HeaderName{
+	"alb-leaf":   asgard.HeaderNameClientCertLeaf,
+	"alb":        asgard.HeaderNameClientCert,
+	"envoy":      asgard.HeaderNameEnvoyXFCC,
+	"nginx":      asgard.HeaderNameNginx,
+	"traefik":    asgard.HeaderNameTraefik,
+	"caddy":      asgard.HeaderNameCaddy,
+	"cloudflare": asgard.HeaderNameCloudflare,
+}
+
 var proxyCmd = &cli.Command{
 	Name:    "identity-proxy",
 	Aliases: []string{"proxy", "id-proxy"},
@@ -38,6 +61,9 @@ var proxyCmd = &cli.Command{
 	Flags: []cli.Flag{
 		caCertFlag,
 		caPrivKeyFlag,
+		kmsEndpointFlag,
+		passphraseFileFlag,
+		allowRSAFlag,
 		&cli.StringFlag{
 			Name:        "backend-url",
 			Usage:       "Proxy requests to `URL`",
@@ -73,6 +99,49 @@ var proxyCmd = &cli.Command{
 				return nil
 			},
 		},
+		&cli.StringFlag{
+			Name: "client-cert-header",
+			Usage: "send client certificates to the backend in `FORMAT`, " +
+				"one of alb-leaf, alb, envoy, nginx, traefik, caddy, or cloudflare",
+			Sources: cli.EnvVars("CLIENT_CERT_HEADER"),
+			Value:   "alb-leaf",
+			Action: func(_ context.Context, _ *cli.Command, f string) error {
+				h, ok := certHeaders[f]
+				if !ok {
+					return fmt.Errorf("unsupported client certificate header format %q", f)
+				}
+				certHeader = h
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:        "proxy-hmac-key-file",
+			Usage:       "sign client certificate headers with the HMAC key in `FILE`",
+			Sources:     cli.EnvVars("PROXY_HMAC_KEY_FILE"),
+			TakesFile:   true,
+			Destination: &proxyHMACKeyFile,
+		},
+		&cli.StringFlag{
+			Name:        "proxy-signing-key",
+			Usage:       "sign client certificate headers with the ECDSA or Ed25519 private key at `URI`",
+			Sources:     cli.EnvVars("PROXY_SIGNING_KEY"),
+			TakesFile:   true,
+			Destination: &proxySigningKey,
+		},
+		&cli.StringFlag{
+			Name:        "policy",
+			Usage:       "authorize requests with the YAML or JSON policy in `FILE`",
+			Sources:     cli.EnvVars("POLICY_FILE"),
+			TakesFile:   true,
+			Destination: &policyFile,
+		},
+		&cli.StringFlag{
+			Name:        "directory",
+			Usage:       "reject clients that are missing or disabled in the YAML or JSON directory in `FILE`",
+			Sources:     cli.EnvVars("DIRECTORY_FILE"),
+			TakesFile:   true,
+			Destination: &directoryFile,
+		},
 		&cli.StringFlag{
 			Name:        "ssl-key-logfile",
 			Usage:       "Log SSL Key information to `FILE`",
@@ -81,7 +150,7 @@ var proxyCmd = &cli.Command{
 		},
 	},
 	Action: func(ctx context.Context, _ *cli.Command) error {
-		caCert, caKey, err := cafiles.GetCertKey(ctx, caCertUri, caPrivKeyUri)
+		caCert, caKey, err := cafiles.GetCertSigner(ctx, caCertUri, caPrivKeyUri, keyOptions()...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error reading cert/key", "error", err)
 			return cli.Exit("Error reading certificate/private key", 1)
@@ -96,10 +165,19 @@ var proxyCmd = &cli.Command{
 			bifrost.Logger().ErrorContext(ctx, "error parsing backend url", "error", err)
 			return cli.Exit("Error parsing backend URL", 1)
 		}
+		// Proxy signatures cover the request host and URI, which the backend must see unchanged.
+		signing := proxyHMACKeyFile != "" || proxySigningKey != ""
+		if signing && (strings.TrimSuffix(burl.Path, "/") != "" || burl.RawQuery != "") {
+			bifrost.Logger().ErrorContext(ctx, "backend url has a path or query", "url", backendUrl)
+			return cli.Exit("Backend URL must not have a path or query when signing headers", 1)
+		}
 		reverseProxy := &httputil.ReverseProxy{
 			Rewrite: func(r *httputil.ProxyRequest) {
 				r.SetURL(burl)
 				r.SetXForwarded()
+				if signing {
+					r.Out.Host = r.In.Host
+				}
 			},
 		}
 
@@ -115,8 +193,51 @@ var proxyCmd = &cli.Command{
 			defer ssllog.Close()
 		}
 
-		hf := asgard.Hofund(asgard.HeaderNameClientCertLeaf, caCert.Namespace)
-		hdlr := webapp.RequestLogger(hf(reverseProxy))
+		var hfOpts []asgard.Option
+		if allowLegacyRSA {
+			hfOpts = append(hfOpts, asgard.WithLegacyRSA())
+		}
+		if proxyHMACKeyFile != "" {
+			key, err := os.ReadFile(proxyHMACKeyFile)
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "error reading HMAC key", "error", err)
+				return cli.Exit("Error reading proxy HMAC key", 1)
+			}
+			hfOpts = append(hfOpts, asgard.WithProxyHMAC(bytes.TrimSpace(key)))
+		}
+		if proxySigningKey != "" {
+			key, err := cafiles.GetSigner(ctx, proxySigningKey, keyOptions()...)
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "error reading signing key", "error", err)
+				return cli.Exit("Error reading proxy signing key", 1)
+			}
+			signerOpt, err := asgard.WithProxySigner(key)
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "invalid signing key", "error", err)
+				return cli.Exit("Proxy signing key must be an ECDSA P-256, P-384, or Ed25519 key", 1)
+			}
+			hfOpts = append(hfOpts, signerOpt)
+		}
+		var backend http.Handler = reverseProxy
+		if policyFile != "" {
+			policy, err := asgard.LoadPolicyFile(ctx, policyFile, policyReloadInterval)
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "error loading policy", "error", err)
+				return cli.Exit("Error loading authorization policy", 1)
+			}
+			backend = asgard.Authorize(policy)(backend)
+		}
+		if directoryFile != "" {
+			dir, err := asgard.LoadDirectoryFile(directoryFile)
+			if err != nil {
+				bifrost.Logger().ErrorContext(ctx, "error loading directory", "error", err)
+				return cli.Exit("Error loading identity directory", 1)
+			}
+			backend = asgard.ResolveIdentity(dir)(backend)
+		}
+
+		hf := asgard.Hofund(certHeader, caCert.Namespace, hfOpts...)
+		hdlr := webapp.RequestLogger(hf(backend))
 
 		serverKey, err := bifrost.NewPrivateKey()
 		if err != nil {
@@ -181,7 +302,8 @@ var proxyCmd = &cli.Command{
 
 func issueTLSCert(
 	caCert *bifrost.Certificate,
-	caKey, serverKey *bifrost.PrivateKey,
+	caKey crypto.Signer,
+	serverKey *bifrost.PrivateKey,
 ) (*bifrost.Certificate, error) {
 	gauntlet := func(_ context.Context, _ *bifrost.CertificateRequest) (*x509.Certificate, error) {
 		// Return a server certificate template that can be used for TLS.
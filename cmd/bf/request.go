@@ -26,6 +26,7 @@ var requestCmd = &cli.Command{
 			Destination: &caUrl,
 		},
 		clientPrivKeyFlag,
+		passphraseFileFlag,
 		outputFlag,
 	},
 	Action: func(ctx context.Context, _ *cli.Command) error {
@@ -37,7 +38,7 @@ var requestCmd = &cli.Command{
 			}
 		}
 
-		key, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri)
+		key, err := cafiles.GetPrivateKey(ctx, clientPrivKeyUri, keyOptions()...)
 		if err != nil {
 			bifrost.Logger().ErrorContext(ctx, "error reading private key", "error", err)
 			return cli.Exit("Failed to read private key", 1)
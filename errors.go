@@ -1,12 +1,27 @@
 package bifrost
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Errors.
 var (
 	// ErrCertificateInvalid is returned when an invalid certificate is parsed.
 	ErrCertificateInvalid = errors.New("bifrost: certificate invalid")
 
+	// ErrCertificateExpired is returned when a certificate is verified after it expired.
+	// It wraps ErrCertificateInvalid.
+	ErrCertificateExpired = fmt.Errorf("%w, certificate expired", ErrCertificateInvalid)
+
+	// ErrCertificateNotYetValid is returned when a certificate is verified before
+	// it becomes valid. It wraps ErrCertificateInvalid.
+	ErrCertificateNotYetValid = fmt.Errorf("%w, certificate not yet valid", ErrCertificateInvalid)
+
+	// ErrCertificateUntrusted is returned when a certificate is not signed by a trusted CA.
+	// It wraps ErrCertificateInvalid.
+	ErrCertificateUntrusted = fmt.Errorf("%w, certificate signed by untrusted CA", ErrCertificateInvalid)
+
 	// ErrRequestDenied is returned when a certificate request is denied by the CA Gauntlet.
 	ErrRequestDenied = errors.New("bifrost: certificate request denied")
 
@@ -15,4 +30,8 @@ var (
 
 	// ErrRequestAborted is returned when the CA Gauntlet function times out or panics.
 	ErrRequestAborted = errors.New("bifrost: certificate request aborted")
+
+	// ErrPrivateKeyEncrypted is returned when an encrypted private key is unmarshaled
+	// without a passphrase.
+	ErrPrivateKeyEncrypted = errors.New("bifrost: private key is encrypted")
 )
@@ -0,0 +1,31 @@
+package bifrost
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TransportCredentials returns gRPC transport credentials set up for TLS Client
+// Authentication (mTLS), for use with grpc.WithTransportCredentials.
+// Like [NewHTTPClient], the credentials request a new certificate from the bifrost caUrl
+// when needed, and renew it before it expires.
+// Background renewal runs until ctx is done, so cancel ctx when the credentials are no
+// longer needed.
+// Use [WithRootCAs] to only trust those Root CAs to authenticate server certs.
+// Only the TLS client config of a transport set with [WithTransport] is used,
+// and [WithTimeout] has no effect.
+func TransportCredentials(
+	ctx context.Context,
+	caUrl string,
+	privkey *PrivateKey,
+	opts ...ClientOption,
+) (credentials.TransportCredentials, error) {
+	o := newClientOptions(caUrl, opts)
+	o.renewal.background = true
+	tlsConfig, err := o.tlsConfig(ctx, privkey)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
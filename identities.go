@@ -0,0 +1,207 @@
+package bifrost
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// IdentityFormat is the encoding an identity was parsed from.
+type IdentityFormat string
+
+// Identity formats supported by [ParseIdentities].
+const (
+	FormatPEM     IdentityFormat = "pem"
+	FormatDER     IdentityFormat = "der"
+	FormatOpenSSH IdentityFormat = "openssh"
+	FormatJWK     IdentityFormat = "jwk"
+	FormatJWKS    IdentityFormat = "jwks"
+)
+
+// ParsedIdentity is an identity found by [ParseIdentities], along with its source.
+type ParsedIdentity struct {
+	*Identity
+
+	// Format is the encoding the identity was found in.
+	Format IdentityFormat
+	// Type is the kind of object the identity was parsed from, named like PEM block types.
+	// For example, "CERTIFICATE", "CERTIFICATE REQUEST", "PUBLIC KEY", or "PRIVATE KEY".
+	Type string
+}
+
+// ParseIdentities returns every identity found in data.
+//
+// data may contain any number of PEM blocks of the types supported by [ParseIdentity],
+// a single ASN.1 DER encoded certificate, certificate request, public key, or private key,
+// OpenSSH public keys one per line (ecdsa-sha2-nistp256, ecdsa-sha2-nistp384, or ssh-ed25519),
+// a JWK, or a JWKS.
+//
+// Objects that cannot be parsed do not stop parsing.
+// ParseIdentities returns the identities it found and an error joining all parse failures.
+// Encrypted private keys fail with [ErrPrivateKeyEncrypted].
+// Legacy RSA keys, and certificates and requests with them, are only accepted with [AllowLegacyRSA].
+func ParseIdentities(data []byte, opts ...ParseOption) ([]*ParsedIdentity, error) {
+	trimmed := bytes.TrimSpace(data)
+
+	var ids []*ParsedIdentity
+	var errs []error
+	switch {
+	case len(trimmed) == 0:
+		return nil, errors.New("bifrost: no identities found")
+	case bytes.Contains(trimmed, []byte("-----BEGIN ")):
+		ids, errs = parsePEMIdentities(trimmed, opts)
+	case trimmed[0] == '{':
+		ids, errs = parseJWKIdentities(trimmed)
+	case isOpenSSH(trimmed):
+		ids, errs = parseSSHIdentities(trimmed, opts)
+	default:
+		id, typ, err := parseDERIdentity(data, opts)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, &ParsedIdentity{Identity: id, Format: FormatDER, Type: typ})
+	}
+
+	if len(ids) == 0 && len(errs) == 0 {
+		return nil, errors.New("bifrost: no identities found")
+	}
+	return ids, errors.Join(errs...)
+}
+
+func parsePEMIdentities(data []byte, opts []ParseOption) ([]*ParsedIdentity, []error) {
+	var ids []*ParsedIdentity
+	var errs []error
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		id, err := parsePEMBlock(block, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s PEM block: %w", block.Type, err))
+			continue
+		}
+		ids = append(ids, &ParsedIdentity{Identity: id, Format: FormatPEM, Type: block.Type})
+	}
+	return ids, errs
+}
+
+func parseJWKIdentities(data []byte) ([]*ParsedIdentity, []error) {
+	var doc struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, []error{fmt.Errorf("bifrost: error decoding JWK: %w", err)}
+	}
+
+	format, keys := FormatJWKS, doc.Keys
+	if doc.Keys == nil {
+		format, keys = FormatJWK, []json.RawMessage{data}
+	}
+
+	var ids []*ParsedIdentity
+	var errs []error
+	for i, raw := range keys {
+		var k jwk
+		if err := json.Unmarshal(raw, &k); err != nil {
+			errs = append(errs, fmt.Errorf("JWK %d: %w", i, err))
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("JWK %d: %w", i, err))
+			continue
+		}
+		typ := "PUBLIC KEY"
+		if k.D != "" {
+			typ = "PRIVATE KEY"
+		}
+		ids = append(ids, &ParsedIdentity{
+			Identity: &Identity{PublicKey: pub},
+			Format:   format,
+			Type:     typ,
+		})
+	}
+	return ids, errs
+}
+
+// isOpenSSH reports whether the first line of data that is not a comment
+// starts with an OpenSSH public key type.
+func isOpenSSH(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		return bytes.HasPrefix(line, []byte("ecdsa-sha2-")) || bytes.HasPrefix(line, []byte("ssh-"))
+	}
+	return false
+}
+
+func parseSSHIdentities(data []byte, opts []ParseOption) ([]*ParsedIdentity, []error) {
+	o := newParseOptions(opts)
+	var ids []*ParsedIdentity
+	var errs []error
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		sshKey, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("OpenSSH key on line %d: %w", i+1, err))
+			continue
+		}
+		cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+		if !ok {
+			errs = append(errs, fmt.Errorf("OpenSSH key on line %d: unsupported key type %s",
+				i+1, sshKey.Type()))
+			continue
+		}
+		pub := cryptoKey.CryptoPublicKey()
+		if err := o.checkKey(pub); err != nil {
+			errs = append(errs, fmt.Errorf("OpenSSH key on line %d: %w", i+1, err))
+			continue
+		}
+		ids = append(ids, &ParsedIdentity{
+			Identity: &Identity{PublicKey: &PublicKey{pub}},
+			Format:   FormatOpenSSH,
+			Type:     "PUBLIC KEY",
+		})
+	}
+	return ids, errs
+}
+
+// parseDERIdentity detects the kind of ASN.1 DER object in data and parses its identity.
+func parseDERIdentity(data []byte, opts []ParseOption) (*Identity, string, error) {
+	o := newParseOptions(opts)
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		c, err := NewCertificate(cert, opts...)
+		if err != nil {
+			return nil, "", err
+		}
+		return &Identity{Namespace: c.Namespace, PublicKey: c.PublicKey}, pemTypeCertificate, nil
+	}
+	if csr, err := x509.ParseCertificateRequest(data); err == nil {
+		c, err := NewCertificateRequest(csr, opts...)
+		if err != nil {
+			return nil, "", err
+		}
+		return &Identity{Namespace: c.Namespace, PublicKey: c.PublicKey}, pemTypeCertificateRequest, nil
+	}
+	if pub, err := x509.ParsePKIXPublicKey(data); err == nil {
+		if err := o.checkKey(pub); err != nil {
+			return nil, "", err
+		}
+		return &Identity{PublicKey: &PublicKey{pub}}, "PUBLIC KEY", nil
+	}
+	key, err := parsePrivateKey(data, o)
+	if err == nil {
+		return &Identity{PublicKey: key.PublicKey()}, "PRIVATE KEY", nil
+	}
+	if errors.Is(err, errLegacyRSA) {
+		return nil, "", err
+	}
+	return nil, "", errors.New("bifrost: unrecognised identity data")
+}
@@ -0,0 +1,234 @@
+package bifrost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseIdentities(t *testing.T) {
+	p256, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := NewP384PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, err := NewEd25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBlock, _ := pem.Decode(newCertTestCases[0].certPem)
+	cert, err := ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(certBlock)
+
+	keyPem, err := p256.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPem, err := p384.PublicKey().MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := ed.PublicKey().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sshKeys []byte
+	for _, k := range []*PrivateKey{p256, p384, ed} {
+		sshPub, err := ssh.NewPublicKey(k.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sshKeys = append(sshKeys, ssh.MarshalAuthorizedKey(sshPub)...)
+	}
+
+	jwks, err := json.Marshal(JWKS{Keys: []*PublicKey{p256.PublicKey(), ed.PublicKey()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	privJWK, err := p384.MarshalJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		key    *PublicKey
+		format IdentityFormat
+		typ    string
+	}
+	tests := []struct {
+		name string
+		in   []byte
+		want []want
+	}{
+		{
+			name: "pem bundle",
+			in:   bytes.Join([][]byte{certPem, keyPem, pubPem}, []byte("\n")),
+			want: []want{
+				{cert.PublicKey, FormatPEM, "CERTIFICATE"},
+				{p256.PublicKey(), FormatPEM, "PRIVATE KEY"},
+				{p384.PublicKey(), FormatPEM, "PUBLIC KEY"},
+			},
+		},
+		{
+			name: "der certificate",
+			in:   certBlock.Bytes,
+			want: []want{{cert.PublicKey, FormatDER, "CERTIFICATE"}},
+		},
+		{
+			name: "der public key",
+			in:   pubDer,
+			want: []want{{ed.PublicKey(), FormatDER, "PUBLIC KEY"}},
+		},
+		{
+			name: "openssh",
+			in:   append([]byte("# authorized keys\n"), sshKeys...),
+			want: []want{
+				{p256.PublicKey(), FormatOpenSSH, "PUBLIC KEY"},
+				{p384.PublicKey(), FormatOpenSSH, "PUBLIC KEY"},
+				{ed.PublicKey(), FormatOpenSSH, "PUBLIC KEY"},
+			},
+		},
+		{
+			name: "jwks",
+			in:   jwks,
+			want: []want{
+				{p256.PublicKey(), FormatJWKS, "PUBLIC KEY"},
+				{ed.PublicKey(), FormatJWKS, "PUBLIC KEY"},
+			},
+		},
+		{
+			name: "jwk",
+			in:   privJWK,
+			want: []want{{p384.PublicKey(), FormatJWK, "PRIVATE KEY"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ids, err := ParseIdentities(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != len(tc.want) {
+				t.Fatalf("got %d identities, want %d", len(ids), len(tc.want))
+			}
+			for i, w := range tc.want {
+				id := ids[i]
+				if !id.PublicKey.Equal(w.key) || id.Format != w.format || id.Type != w.typ {
+					t.Fatalf("identity %d: got %s %s, want %s %s", i, id.Format, id.Type, w.format, w.typ)
+				}
+			}
+		})
+	}
+
+	if ids, _ := ParseIdentities(certPem); ids[0].Namespace != cert.Namespace {
+		t.Fatalf("got namespace %s, want %s", ids[0].Namespace, cert.Namespace)
+	}
+}
+
+func TestParseIdentities_errors(t *testing.T) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := key.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encPem, err := key.MarshalEncryptedText([]byte("correct-horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parsing continues past bad blocks.
+	ids, err := ParseIdentities(append(encPem, keyPem...))
+	if !errors.Is(err, ErrPrivateKeyEncrypted) {
+		t.Fatalf("expected ErrPrivateKeyEncrypted, got %v", err)
+	}
+	if len(ids) != 1 || !ids[0].PublicKey.Equal(key.PublicKey()) {
+		t.Fatalf("expected the unencrypted key, got %v", ids)
+	}
+
+	for _, in := range []string{"", " \n", "a@b", "{}", `{"keys":[{"kty":"RSA"}]}`, "ssh-rsa AAAA"} {
+		if _, err := ParseIdentities([]byte(in)); err == nil {
+			t.Errorf("ParseIdentities(%q) expected error", in)
+		}
+	}
+}
+
+func TestParseIdentities_legacyRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, MinimumRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+	privPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer})
+
+	inputs := map[string][]byte{
+		"pem public key":  pubPem,
+		"pem private key": privPem,
+		"der public key":  pubDer,
+		"der private key": privDer,
+		"openssh":         ssh.MarshalAuthorizedKey(sshPub),
+	}
+	for name, in := range inputs {
+		t.Run(name, func(t *testing.T) {
+			if ids, err := ParseIdentities(in); err == nil || len(ids) != 0 {
+				t.Fatalf("expected RSA key to be rejected, got %d identities", len(ids))
+			}
+			ids, err := ParseIdentities(in, AllowLegacyRSA())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 1 || ids[0].PublicKey.Type() != KeyTypeRSA {
+				t.Fatalf("expected one RSA identity, got %v", ids)
+			}
+		})
+	}
+
+	if _, err := ParseIdentity(pubPem); err == nil {
+		t.Fatal("expected ParseIdentity to reject RSA keys")
+	}
+	if _, err := ParseIdentity(privPem, AllowLegacyRSA()); err != nil {
+		t.Fatal(err)
+	}
+
+	var pub PublicKey
+	if err := pub.UnmarshalBinary(pubDer); err == nil {
+		t.Fatal("expected PublicKey.UnmarshalBinary to reject RSA keys")
+	}
+	if _, err := ParsePublicKey(pubDer, AllowLegacyRSA()); err != nil {
+		t.Fatal(err)
+	}
+	var priv PrivateKey
+	if err := priv.UnmarshalText(privPem); err == nil {
+		t.Fatal("expected PrivateKey.UnmarshalText to reject RSA keys")
+	}
+}
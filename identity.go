@@ -1,15 +1,19 @@
 package bifrost
 
 import (
-	"crypto/x509"
+	"bytes"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 )
 
 // Identity represents a unique identity in the system.
+// Identity implements the Marshaler and Unmarshaler interfaces for binary, text, JSON, and DynamoDB.
 type Identity struct {
 	Namespace uuid.UUID
 	PublicKey *PublicKey
@@ -23,50 +27,214 @@ func (i Identity) String() string {
 	return i.UUID().String()
 }
 
-// ParseIdentity parses a Bifrost identity from a PEM-encoded block.
+// pemHeaderNamespace is the PEM header that holds the namespace of an identity.
+const pemHeaderNamespace = "Namespace"
+
+// MarshalBinary marshals the identity to the 16 byte namespace
+// followed by the public key in PKIX, ASN.1 DER form.
+func (i Identity) MarshalBinary() ([]byte, error) {
+	if i.PublicKey == nil {
+		return nil, errors.New("bifrost: identity public key is nil")
+	}
+	keyDer, err := i.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(i.Namespace[:], keyDer...), nil
+}
+
+// UnmarshalBinary unmarshals the identity from the 16 byte namespace
+// followed by the public key in PKIX, ASN.1 DER form.
+func (i *Identity) UnmarshalBinary(data []byte) error {
+	if len(data) < len(uuid.Nil) {
+		return errors.New("bifrost: identity too short")
+	}
+	var pubkey PublicKey
+	if err := pubkey.UnmarshalBinary(data[len(uuid.Nil):]); err != nil {
+		return err
+	}
+	i.Namespace = uuid.UUID(data[:len(uuid.Nil)])
+	i.PublicKey = &pubkey
+	return nil
+}
+
+// MarshalText marshals the identity to a PEM encoded PKIX public key.
+// The namespace is stored in the Namespace PEM header.
+func (i Identity) MarshalText() ([]byte, error) {
+	if i.PublicKey == nil {
+		return nil, errors.New("bifrost: identity public key is nil")
+	}
+	keyDer, err := i.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	block := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: keyDer,
+	}
+	if i.Namespace != uuid.Nil {
+		block.Headers = map[string]string{pemHeaderNamespace: i.Namespace.String()}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// UnmarshalText unmarshals the identity from a PEM encoded PKIX public key.
+// The namespace is read from the Namespace PEM header, if present.
+func (i *Identity) UnmarshalText(text []byte) error {
+	block, _ := pem.Decode(text)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return errors.New("bifrost: invalid identity PEM block")
+	}
+	id, err := parsePublicKeyBlock(block, nil)
+	if err != nil {
+		return err
+	}
+	*i = *id
+	return nil
+}
+
+// identityDoc is the JSON and DynamoDB representation of an identity.
+type identityDoc struct {
+	ID        string     `json:"id,omitempty"        dynamodbav:"id,omitempty"`
+	Namespace string     `json:"namespace,omitempty" dynamodbav:"namespace,omitempty"`
+	PublicKey *PublicKey `json:"publicKey"           dynamodbav:"publicKey"`
+}
+
+func (i Identity) doc() (*identityDoc, error) {
+	if i.PublicKey == nil {
+		return nil, errors.New("bifrost: identity public key is nil")
+	}
+	doc := identityDoc{PublicKey: i.PublicKey}
+	if i.Namespace != uuid.Nil {
+		doc.ID = i.UUID().String()
+		doc.Namespace = i.Namespace.String()
+	}
+	return &doc, nil
+}
+
+// fromDoc sets i from doc and checks that the ID, if present, matches the public key.
+func (i *Identity) fromDoc(doc *identityDoc) error {
+	if doc.PublicKey == nil || doc.PublicKey.PublicKey == nil {
+		return errors.New("bifrost: identity public key is missing")
+	}
+	id := Identity{PublicKey: doc.PublicKey}
+	if doc.Namespace != "" {
+		ns, err := uuid.Parse(doc.Namespace)
+		if err != nil {
+			return fmt.Errorf("bifrost: invalid identity namespace: %w", err)
+		}
+		id.Namespace = ns
+	}
+	if doc.ID != "" {
+		docID, err := uuid.Parse(doc.ID)
+		if err != nil {
+			return fmt.Errorf("bifrost: invalid identity id: %w", err)
+		}
+		if docID != id.UUID() {
+			return errors.New("bifrost: identity id does not match public key")
+		}
+	}
+	*i = id
+	return nil
+}
+
+// MarshalJSON marshals the identity to a JSON object with the id, namespace,
+// and PEM encoded PKIX public key.
+func (i Identity) MarshalJSON() ([]byte, error) {
+	doc, err := i.doc()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON unmarshals the identity from a JSON object with the id, namespace,
+// and PEM encoded PKIX public key.
+// The id, if present, must match the namespace and public key.
+func (i *Identity) UnmarshalJSON(data []byte) error {
+	var doc identityDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return i.fromDoc(&doc)
+}
+
+// MarshalDynamoDBAttributeValue marshals the identity to a map with the id, namespace,
+// and PKIX, ASN.1 DER public key.
+func (i Identity) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	doc, err := i.doc()
+	if err != nil {
+		return nil, err
+	}
+	return attributevalue.Marshal(doc)
+}
+
+// UnmarshalDynamoDBAttributeValue unmarshals the identity from a map with the id, namespace,
+// and PKIX, ASN.1 DER public key.
+// The id, if present, must match the namespace and public key.
+func (i *Identity) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var doc identityDoc
+	if err := attributevalue.Unmarshal(av, &doc); err != nil {
+		return err
+	}
+	return i.fromDoc(&doc)
+}
+
+// ParseIdentity parses a Bifrost identity from a PEM-encoded block or a JSON Web Key.
 // The block may contain a private key, public key, certificate, or certificate request.
 //
 // If the block contains a private or a public key,
 // the returned identity will contain the public key.
+// Public key blocks may carry the namespace in a Namespace header, see [Identity.MarshalText].
+// If the block contains an encrypted private key, the returned error is [ErrPrivateKeyEncrypted].
 // If the block contains a certificate or certificate request,
 // the returned identity will contain the public key and namespace.
-func ParseIdentity(data []byte) (*Identity, error) {
+// If data is a public or private JWK, the returned identity will contain the public key.
+// Legacy RSA keys, and certificates and requests with them, are only accepted with [AllowLegacyRSA].
+func ParseIdentity(data []byte, opts ...ParseOption) (*Identity, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var pubkey PublicKey
+		if err := pubkey.UnmarshalJWK(trimmed); err != nil {
+			return nil, err
+		}
+		return &Identity{
+			PublicKey: &pubkey,
+		}, nil
+	}
+
 	block, _ := pem.Decode(data)
 	if block == nil {
 		return nil, errors.New("no PEM data found")
 	}
+	return parsePEMBlock(block, opts)
+}
 
+// parsePEMBlock parses an identity from a PEM block.
+func parsePEMBlock(block *pem.Block, opts []ParseOption) (*Identity, error) {
 	// Parse the key or certificate.
 	switch block.Type {
 	case "PRIVATE KEY":
-		var privkey PrivateKey
-		if err := privkey.UnmarshalBinary(block.Bytes); err != nil {
+		privkey, err := parsePrivateKey(block.Bytes, newParseOptions(opts))
+		if err != nil {
 			return nil, err
 		}
 		return &Identity{
 			PublicKey: privkey.PublicKey(),
 		}, nil
 	case "EC PRIVATE KEY":
-		pk, err := x509.ParseECPrivateKey(block.Bytes)
-		if err != nil {
+		var privkey PrivateKey
+		if err := privkey.UnmarshalText(pem.EncodeToMemory(block)); err != nil {
 			return nil, err
 		}
-		pubkey := PublicKey{
-			PublicKey: &pk.PublicKey,
-		}
 		return &Identity{
-			PublicKey: &pubkey,
+			PublicKey: privkey.PublicKey(),
 		}, nil
+	case pemTypeEncryptedPrivateKey:
+		return nil, ErrPrivateKeyEncrypted
 	case "PUBLIC KEY":
-		var pubkey PublicKey
-		if err := pubkey.UnmarshalBinary(block.Bytes); err != nil {
-			return nil, err
-		}
-		return &Identity{
-			PublicKey: &pubkey,
-		}, nil
+		return parsePublicKeyBlock(block, opts)
 	case "CERTIFICATE":
-		cert, err := ParseCertificate(block.Bytes)
+		cert, err := ParseCertificate(block.Bytes, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -76,7 +244,7 @@ func ParseIdentity(data []byte) (*Identity, error) {
 			PublicKey: cert.PublicKey,
 		}, nil
 	case "CERTIFICATE REQUEST":
-		csr, err := ParseCertificateRequest(block.Bytes)
+		csr, err := ParseCertificateRequest(block.Bytes, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -89,3 +257,21 @@ func ParseIdentity(data []byte) (*Identity, error) {
 		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
 	}
 }
+
+// parsePublicKeyBlock parses a PUBLIC KEY PEM block,
+// with the namespace from the optional Namespace header.
+func parsePublicKeyBlock(block *pem.Block, opts []ParseOption) (*Identity, error) {
+	pubkey, err := ParsePublicKey(block.Bytes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	id := Identity{PublicKey: pubkey}
+	if nsHeader, ok := block.Headers[pemHeaderNamespace]; ok {
+		ns, err := uuid.Parse(nsHeader)
+		if err != nil {
+			return nil, fmt.Errorf("bifrost: invalid identity namespace: %w", err)
+		}
+		id.Namespace = ns
+	}
+	return &id, nil
+}
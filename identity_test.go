@@ -3,10 +3,13 @@ package bifrost
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"encoding/json"
+	"fmt"
 	"math/big"
 	"reflect"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/google/uuid"
 )
 
@@ -75,3 +78,92 @@ func TestParseIdentity(t *testing.T) {
 		}
 	}
 }
+
+func TestIdentity_Marshalers(t *testing.T) {
+	key, err := NewP384PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+
+	for _, id := range []Identity{
+		{Namespace: ns, PublicKey: key.PublicKey()},
+		{PublicKey: key.PublicKey()},
+	} {
+		t.Run(id.Namespace.String(), func(t *testing.T) {
+			check := func(t *testing.T, got *Identity) {
+				t.Helper()
+				if got.Namespace != id.Namespace || !got.PublicKey.Equal(id.PublicKey) {
+					t.Fatalf("got %#v, want %#v", got, id)
+				}
+			}
+
+			data, err := id.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Identity
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			check(t, &got)
+
+			data, err = id.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = Identity{}
+			if err := got.UnmarshalText(data); err != nil {
+				t.Fatal(err)
+			}
+			check(t, &got)
+
+			parsed, err := ParseIdentity(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, parsed)
+
+			data, err = json.Marshal(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = Identity{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			check(t, &got)
+
+			item, err := attributevalue.MarshalMap(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = Identity{}
+			if err := attributevalue.UnmarshalMap(item, &got); err != nil {
+				t.Fatal(err)
+			}
+			check(t, &got)
+		})
+	}
+}
+
+func TestIdentity_UnmarshalJSON_idMismatch(t *testing.T) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubJSON, err := key.PublicKey().MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf(`{"id":%q,"namespace":%q,"publicKey":%s}`,
+		uuid.New(), uuid.New(), pubJSON)
+
+	var id Identity
+	if err := json.Unmarshal([]byte(data), &id); err == nil {
+		t.Fatal("expected error for mismatched id")
+	}
+	if err := json.Unmarshal([]byte(`{"namespace":"`+uuid.NewString()+`"}`), &id); err == nil {
+		t.Fatal("expected error for missing public key")
+	}
+}
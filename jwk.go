@@ -0,0 +1,286 @@
+package bifrost
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JSON Web Key parameter values used by bifrost keys (RFC 7518, RFC 8037).
+const (
+	jwkTypeEC       = "EC"
+	jwkTypeOKP      = "OKP"
+	jwkCurveP256    = "P-256"
+	jwkCurveP384    = "P-384"
+	jwkCurveEd25519 = "Ed25519"
+	jwkUseSignature = "sig"
+)
+
+// jwk is the JSON representation of a JSON Web Key (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// publicJWK returns the public members of the JSON Web Key for p.
+func (p PublicKey) publicJWK() (*jwk, error) {
+	switch k := p.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		var crv, alg string
+		switch p.Type() {
+		case KeyTypeP256:
+			crv, alg = jwkCurveP256, "ES256"
+		case KeyTypeP384:
+			crv, alg = jwkCurveP384, "ES384"
+		default:
+			return nil, fmt.Errorf("bifrost: unsupported JWK elliptic curve %s", k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &jwk{
+			Kty: jwkTypeEC,
+			Crv: crv,
+			X:   b64.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y:   b64.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+			Use: jwkUseSignature,
+			Alg: alg,
+		}, nil
+	case ed25519.PublicKey:
+		return &jwk{
+			Kty: jwkTypeOKP,
+			Crv: jwkCurveEd25519,
+			X:   b64.EncodeToString(k),
+			Use: jwkUseSignature,
+			Alg: "EdDSA",
+		}, nil
+	default:
+		return nil, fmt.Errorf("bifrost: unsupported JWK key type %T", p.PublicKey)
+	}
+}
+
+// Thumbprint returns the base64url encoded RFC 7638 SHA-256 JWK thumbprint of p.
+// The thumbprint is used as the key ID of marshaled JWKs.
+func (p PublicKey) Thumbprint() (string, error) {
+	k, err := p.publicJWK()
+	if err != nil {
+		return "", err
+	}
+	return k.thumbprint(), nil
+}
+
+// thumbprint hashes the required members of k in lexicographic order (RFC 7638 section 3.2).
+func (k *jwk) thumbprint() string {
+	var members string
+	switch k.Kty {
+	case jwkTypeEC:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case jwkTypeOKP:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return b64.EncodeToString(sum[:])
+}
+
+// MarshalJWK marshals p to a JSON Web Key with its thumbprint as the key ID.
+// P-256 and P-384 keys are EC keys, Ed25519 keys are OKP keys.
+func (p PublicKey) MarshalJWK() ([]byte, error) {
+	k, err := p.publicJWK()
+	if err != nil {
+		return nil, err
+	}
+	k.Kid = k.thumbprint()
+	return json.Marshal(k)
+}
+
+// UnmarshalJWK unmarshals a public key from a JSON Web Key.
+// Private members of the JWK are ignored.
+func (p *PublicKey) UnmarshalJWK(data []byte) error {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return fmt.Errorf("bifrost: error decoding JWK: %w", err)
+	}
+	pub, err := k.publicKey()
+	if err != nil {
+		return err
+	}
+	p.PublicKey = pub.PublicKey
+	return nil
+}
+
+// publicKey returns the public key described by the public members of k.
+func (k *jwk) publicKey() (*PublicKey, error) {
+	x, err := b64.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("bifrost: invalid JWK x: %w", err)
+	}
+
+	switch k.Kty {
+	case jwkTypeEC:
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case jwkCurveP256:
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case jwkCurveP384:
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		default:
+			return nil, fmt.Errorf("bifrost: unsupported JWK curve %q", k.Crv)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bifrost: invalid JWK y: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("bifrost: invalid JWK curve point size")
+		}
+		// ecdh validates that the point is on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("bifrost: invalid JWK curve point: %w", err)
+		}
+		return &PublicKey{&ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case jwkTypeOKP:
+		if k.Crv != jwkCurveEd25519 {
+			return nil, fmt.Errorf("bifrost: unsupported JWK curve %q", k.Crv)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bifrost: invalid JWK Ed25519 public key size")
+		}
+		return &PublicKey{ed25519.PublicKey(x)}, nil
+	default:
+		return nil, fmt.Errorf("bifrost: unsupported JWK key type %q", k.Kty)
+	}
+}
+
+// MarshalJWK marshals p to a JSON Web Key with its private members
+// and its public key thumbprint as the key ID.
+func (p PrivateKey) MarshalJWK() ([]byte, error) {
+	k, err := p.PublicKey().publicJWK()
+	if err != nil {
+		return nil, err
+	}
+	switch priv := p.PrivateKey.(type) {
+	case *ecdsa.PrivateKey:
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		k.D = b64.EncodeToString(priv.D.FillBytes(make([]byte, size)))
+	case ed25519.PrivateKey:
+		k.D = b64.EncodeToString(priv.Seed())
+	default:
+		return nil, fmt.Errorf("bifrost: unsupported JWK key type %T", p.PrivateKey)
+	}
+	k.Kid = k.thumbprint()
+	return json.Marshal(k)
+}
+
+// UnmarshalJWK unmarshals a private key from a JSON Web Key.
+// The public members of the JWK must match the private key.
+func (p *PrivateKey) UnmarshalJWK(data []byte) error {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return fmt.Errorf("bifrost: error decoding JWK: %w", err)
+	}
+	if k.D == "" {
+		return errors.New("bifrost: JWK is not a private key")
+	}
+	pub, err := k.publicKey()
+	if err != nil {
+		return err
+	}
+	d, err := b64.DecodeString(k.D)
+	if err != nil {
+		return fmt.Errorf("bifrost: invalid JWK d: %w", err)
+	}
+
+	var priv PrivateKey
+	switch pk := pub.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		ecdhCurve := ecdh.P256()
+		if pk.Curve == elliptic.P384() {
+			ecdhCurve = ecdh.P384()
+		}
+		ecdhKey, err := ecdhCurve.NewPrivateKey(d)
+		if err != nil {
+			return fmt.Errorf("bifrost: invalid JWK private key: %w", err)
+		}
+		point := append(append([]byte{4}, pk.X.FillBytes(make([]byte, len(d)))...),
+			pk.Y.FillBytes(make([]byte, len(d)))...)
+		if !bytes.Equal(ecdhKey.PublicKey().Bytes(), point) {
+			return errors.New("bifrost: JWK private key does not match public key")
+		}
+		priv.PrivateKey = &ecdsa.PrivateKey{PublicKey: *pk, D: new(big.Int).SetBytes(d)}
+	case ed25519.PublicKey:
+		if len(d) != ed25519.SeedSize {
+			return errors.New("bifrost: invalid JWK Ed25519 private key size")
+		}
+		key := ed25519.NewKeyFromSeed(d)
+		if !pk.Equal(key.Public()) {
+			return errors.New("bifrost: JWK private key does not match public key")
+		}
+		priv.PrivateKey = key
+	}
+	*p = priv
+	return nil
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517 section 5) of bifrost public keys.
+type JWKS struct {
+	Keys []*PublicKey
+}
+
+// MarshalJSON marshals s to a JWKS document.
+func (s JWKS) MarshalJSON() ([]byte, error) {
+	keys := make([]json.RawMessage, 0, len(s.Keys))
+	for _, key := range s.Keys {
+		k, err := key.MarshalJWK()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return json.Marshal(struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{keys})
+}
+
+// UnmarshalJSON unmarshals the public keys in a JWKS document.
+func (s *JWKS) UnmarshalJSON(data []byte) error {
+	var doc struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("bifrost: error decoding JWKS: %w", err)
+	}
+	if doc.Keys == nil {
+		return errors.New("bifrost: JWKS has no keys member")
+	}
+	keys := make([]*PublicKey, 0, len(doc.Keys))
+	for _, raw := range doc.Keys {
+		var key PublicKey
+		if err := key.UnmarshalJWK(raw); err != nil {
+			return err
+		}
+		keys = append(keys, &key)
+	}
+	s.Keys = keys
+	return nil
+}
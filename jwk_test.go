@@ -0,0 +1,169 @@
+package bifrost
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Ed25519 key from RFC 8037 appendix A.
+const (
+	testEd25519PrivJWK = `{"kty":"OKP","crv":"Ed25519",
+"d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A",
+"x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+	testEd25519PubJWK = `{"kty":"OKP","crv":"Ed25519",
+"x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+	testEd25519Thumbprint = "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+)
+
+func TestPublicKey_Thumbprint(t *testing.T) {
+	var pub PublicKey
+	if err := pub.UnmarshalJWK([]byte(testEd25519PubJWK)); err != nil {
+		t.Fatal(err)
+	}
+	tp, err := pub.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp != testEd25519Thumbprint {
+		t.Fatalf("got thumbprint %s, want %s", tp, testEd25519Thumbprint)
+	}
+
+	var priv PrivateKey
+	if err := priv.UnmarshalJWK([]byte(testEd25519PrivJWK)); err != nil {
+		t.Fatal(err)
+	}
+	if !priv.PublicKey().Equal(&pub) {
+		t.Fatal("expected private key to match public key")
+	}
+}
+
+func TestPrivateKey_MarshalUnmarshalJWK(t *testing.T) {
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeP384, KeyTypeEd25519} {
+		key, err := GeneratePrivateKey(kt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := key.MarshalJWK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var key2 PrivateKey
+		if err := key2.UnmarshalJWK(data); err != nil {
+			t.Fatal(err)
+		}
+		if !key.PublicKey().Equal(key2.PublicKey()) {
+			t.Fatalf("%s key did not round trip through JWK", kt)
+		}
+
+		// Private JWKs parse as public keys and identities.
+		id, err := ParseIdentity(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !id.PublicKey.Equal(key.PublicKey()) {
+			t.Fatalf("%s JWK identity does not match", kt)
+		}
+
+		pubData, err := key.PublicKey().MarshalJWK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var members map[string]string
+		if err := json.Unmarshal(pubData, &members); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := members["d"]; ok {
+			t.Fatalf("%s public JWK has private member", kt)
+		}
+		tp, err := key.PublicKey().Thumbprint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if members["kid"] != tp {
+			t.Fatalf("got kid %s, want %s", members["kid"], tp)
+		}
+		if err := key2.UnmarshalJWK(pubData); err == nil {
+			t.Fatal("expected error unmarshaling public JWK as private key")
+		}
+	}
+}
+
+var unmarshalJWKErrorTests = []string{
+	``,
+	`{}`,
+	`{"kty":"RSA","n":"AQAB","e":"AQAB"}`,
+	`{"kty":"OKP","crv":"X25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+	`{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg"}`,
+	`{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}`,
+	// Point not on the curve.
+	`{"kty":"EC","crv":"P-256",
+"x":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE",
+"y":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE"}`,
+}
+
+func TestPublicKey_UnmarshalJWK_errors(t *testing.T) {
+	for _, tc := range unmarshalJWKErrorTests {
+		var pub PublicKey
+		if err := pub.UnmarshalJWK([]byte(tc)); err == nil {
+			t.Errorf("UnmarshalJWK(%q) expected error", tc)
+		}
+	}
+}
+
+func TestPrivateKey_UnmarshalJWK_mismatch(t *testing.T) {
+	other, err := NewEd25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := other.MarshalJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		t.Fatal(err)
+	}
+	k.X = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	data, err = json.Marshal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var priv PrivateKey
+	if err := priv.UnmarshalJWK(data); err == nil {
+		t.Fatal("expected error for mismatched private key")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	var keys []*PublicKey
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeP384, KeyTypeEd25519} {
+		key, err := GeneratePrivateKey(kt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key.PublicKey())
+	}
+
+	data, err := json.Marshal(JWKS{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != len(keys) {
+		t.Fatalf("got %d keys, want %d", len(set.Keys), len(keys))
+	}
+	for i, key := range set.Keys {
+		if !key.Equal(keys[i]) {
+			t.Fatalf("key %d did not round trip through JWKS", i)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"foo":[]}`), &set); err == nil {
+		t.Fatal("expected error for JWKS without keys")
+	}
+}
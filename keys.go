@@ -8,39 +8,102 @@
 package bifrost
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
+	"github.com/youmark/pkcs8"
 )
 
 // Signature and Public Key Algorithms.
+// These are the defaults used with P-256 keys.
 const (
 	SignatureAlgorithm = x509.ECDSAWithSHA256
 	PublicKeyAlgorithm = x509.ECDSA
 )
 
+// KeyType is the type of a bifrost identity key.
+type KeyType string
+
+// Supported key types.
+const (
+	KeyTypeP256    KeyType = "p256"
+	KeyTypeP384    KeyType = "p384"
+	KeyTypeEd25519 KeyType = "ed25519"
+
+	// KeyTypeRSA identifies legacy RSA keys.
+	// RSA keys cannot be generated by bifrost and are only accepted in certificates
+	// and certificate requests when explicitly allowed with [AllowLegacyRSA].
+	KeyTypeRSA KeyType = "rsa"
+)
+
+// MinimumRSAKeySize is the smallest RSA modulus size, in bits, accepted by bifrost.
+const MinimumRSAKeySize = 2048
+
+// ParseKeyType parses a key type name.
+// Names are case sensitive, an empty name selects [KeyTypeP256].
+func ParseKeyType(s string) (KeyType, error) {
+	switch kt := KeyType(s); kt {
+	case "":
+		return KeyTypeP256, nil
+	case KeyTypeP256, KeyTypeP384, KeyTypeEd25519:
+		return kt, nil
+	default:
+		return "", fmt.Errorf("bifrost: unsupported key type %q", s)
+	}
+}
+
 // StatsForNerds captures metrics from various bifrost processes.
 var StatsForNerds = metrics.NewSet()
 
-// PublicKey is a wrapper around an ECDSA public key.
+// PublicKey is a wrapper around an ECDSA P-256, ECDSA P-384, or Ed25519 public key.
 // It implements the Marshaler and Unmarshaler interfaces for binary, text, JSON, and DynamoDB.
 // Keys are serialsed in PKIX, ASN.1 DER form.
 type PublicKey struct {
-	*ecdsa.PublicKey
+	crypto.PublicKey
 }
 
 func (p *PublicKey) Equal(other *PublicKey) bool {
-	return p.PublicKey.Equal(other.PublicKey)
+	if p == nil || other == nil {
+		return p == other
+	}
+	k, ok := p.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(other.PublicKey)
+}
+
+// Type returns the key type of p, or an empty string if the key is unsupported.
+func (p PublicKey) Type() KeyType {
+	kt, _ := publicKeyType(p.PublicKey)
+	return kt
+}
+
+// SignatureAlgorithm returns the x509 signature algorithm used with p.
+func (p PublicKey) SignatureAlgorithm() x509.SignatureAlgorithm {
+	switch p.Type() {
+	case KeyTypeP256:
+		return x509.ECDSAWithSHA256
+	case KeyTypeP384:
+		return x509.ECDSAWithSHA384
+	case KeyTypeEd25519:
+		return x509.PureEd25519
+	case KeyTypeRSA:
+		return x509.SHA256WithRSA
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
 }
 
 // UUID returns a unique identifier derived from the namespace and the client's public key.
@@ -57,19 +120,29 @@ func (p PublicKey) MarshalBinary() ([]byte, error) {
 }
 
 // UnmarshalBinary unmarshals a public key from PKIX, ASN.1 DER form.
+// Legacy RSA keys are rejected, use [ParsePublicKey] with [AllowLegacyRSA] to accept them.
 func (p *PublicKey) UnmarshalBinary(data []byte) error {
-	pub, err := x509.ParsePKIXPublicKey(data)
+	pub, err := ParsePublicKey(data)
 	if err != nil {
 		return err
 	}
-	pk, ok := pub.(*ecdsa.PublicKey)
-	if !ok {
-		return fmt.Errorf("bifrost: unexpected key type %T", pub)
-	}
-	p.PublicKey = pk
+	*p = *pub
 	return nil
 }
 
+// ParsePublicKey parses a public key in PKIX, ASN.1 DER form.
+// Legacy RSA keys are only accepted with [AllowLegacyRSA].
+func ParsePublicKey(der []byte, opts ...ParseOption) (*PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := newParseOptions(opts).checkKey(pub); err != nil {
+		return nil, err
+	}
+	return &PublicKey{PublicKey: pub}, nil
+}
+
 // MarshalText marshals the public key to a PEM encoded PKIX Public Key in ASN.1 DER form.
 func (p PublicKey) MarshalText() ([]byte, error) {
 	keyDer, err := p.MarshalBinary()
@@ -130,25 +203,83 @@ func (p *PublicKey) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) err
 	return p.UnmarshalBinary(keyDer)
 }
 
-// PrivateKey is a wrapper around an ECDSA private key.
+// PrivateKey is a wrapper around an ECDSA P-256, ECDSA P-384, or Ed25519 private key.
 // PrivateKey implements the Marshaler and Unmarshaler interfaces for binary, text, JSON, and DynamoDB.
-// Keys are generated using the P-256 elliptic curve.
+// PrivateKey implements [crypto.Signer].
 // Keys are serialised in PKCS #8, ASN.1 DER form.
 type PrivateKey struct {
-	*ecdsa.PrivateKey
+	crypto.PrivateKey
 }
 
-// NewPrivateKey generates a new bifrost private key.
+// NewPrivateKey generates a new bifrost private key using the P-256 elliptic curve.
 func NewPrivateKey() (*PrivateKey, error) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		PrivateKey: key,
+	}, nil
+}
+
+// NewP384PrivateKey generates a new bifrost private key using the P-384 elliptic curve.
+func NewP384PrivateKey() (*PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
 	return &PrivateKey{
 		PrivateKey: key,
-	}, err
+	}, nil
+}
+
+// NewEd25519PrivateKey generates a new bifrost Ed25519 private key.
+func NewEd25519PrivateKey() (*PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		PrivateKey: key,
+	}, nil
+}
+
+// GeneratePrivateKey generates a new bifrost private key of type kt.
+func GeneratePrivateKey(kt KeyType) (*PrivateKey, error) {
+	switch kt {
+	case KeyTypeP256:
+		return NewPrivateKey()
+	case KeyTypeP384:
+		return NewP384PrivateKey()
+	case KeyTypeEd25519:
+		return NewEd25519PrivateKey()
+	default:
+		return nil, fmt.Errorf("bifrost: unsupported key type %q", kt)
+	}
+}
+
+// Public returns the public key corresponding to p.
+// It returns nil if p does not wrap a [crypto.Signer].
+func (p PrivateKey) Public() crypto.PublicKey {
+	s, ok := p.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+	return s.Public()
+}
+
+// Sign signs digest with p.
+func (p PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s, ok := p.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("bifrost: unexpected key type %T", p.PrivateKey)
+	}
+	return s.Sign(rand, digest, opts)
 }
 
 // PublicKey returns the public key corresponding to p.
 func (p PrivateKey) PublicKey() *PublicKey {
-	return &PublicKey{&p.PrivateKey.PublicKey}
+	return &PublicKey{p.Public()}
 }
 
 // MarshalBinary converts a private key to PKCS #8, ASN.1 DER form.
@@ -158,22 +289,37 @@ func (p PrivateKey) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary parses an unencrypted private key in PKCS #8, ASN.1 DER form.
 // Unmarshal also supports private keys in SEC.1, ASN.1 DER form for backward compatibility.
+// Legacy RSA keys are rejected.
 func (p *PrivateKey) UnmarshalBinary(data []byte) error {
-	priv, err := x509.ParsePKCS8PrivateKey(data)
+	key, err := parsePrivateKey(data, newParseOptions(nil))
+	if err != nil {
+		return err
+	}
+	*p = *key
+	return nil
+}
+
+// parsePrivateKey parses an unencrypted private key in PKCS #8 or SEC.1, ASN.1 DER form.
+func parsePrivateKey(der []byte, o *parseOptions) (*PrivateKey, error) {
+	priv, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
 		// Try to parse as an EC private key for backward compatibility.
-		if priv, err := x509.ParseECPrivateKey(data); err == nil {
-			p.PrivateKey = priv
-			return nil
+		if priv, err := x509.ParseECPrivateKey(der); err == nil {
+			if _, err := publicKeyType(&priv.PublicKey); err != nil {
+				return nil, err
+			}
+			return &PrivateKey{PrivateKey: priv}, nil
 		}
-		return err
+		return nil, err
 	}
-	k, ok := priv.(*ecdsa.PrivateKey)
+	s, ok := priv.(crypto.Signer)
 	if !ok {
-		return fmt.Errorf("bifrost: unexpected key type %T", priv)
+		return nil, fmt.Errorf("bifrost: unexpected key type %T", priv)
 	}
-	p.PrivateKey = k
-	return nil
+	if err := o.checkKey(s.Public()); err != nil {
+		return nil, err
+	}
+	return &PrivateKey{PrivateKey: priv}, nil
 }
 
 // MarshalText marshals the key to a PEM encoded PKCS #8, ASN.1 DER form.
@@ -191,6 +337,7 @@ func (p PrivateKey) MarshalText() ([]byte, error) {
 
 // UnmarshalText unmarshals the private key from PEM encoded PKCS #8, ASN.1 DER form.
 // Unmarshal also supports EC PRIVATE KEY PEM blocks for backward compatibility.
+// Encrypted keys return [ErrPrivateKeyEncrypted], use UnmarshalEncryptedText instead.
 func (p *PrivateKey) UnmarshalText(text []byte) error {
 	block, _ := pem.Decode(text)
 	if block == nil {
@@ -204,13 +351,75 @@ func (p *PrivateKey) UnmarshalText(text []byte) error {
 		if err != nil {
 			return err
 		}
+		if _, err := publicKeyType(&pk.PublicKey); err != nil {
+			return err
+		}
 		p.PrivateKey = pk
 		return nil
+	case pemTypeEncryptedPrivateKey:
+		return ErrPrivateKeyEncrypted
 	default:
 		return fmt.Errorf("bifrost: unsupported PEM block type %q", block.Type)
 	}
 }
 
+const pemTypeEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+
+// encryptedKeyOpts are used to encrypt private keys.
+// scrypt with AES-256-CBC is compatible with "openssl pkcs8 -topk8 -scrypt".
+var encryptedKeyOpts = &pkcs8.Opts{
+	Cipher: pkcs8.AES256CBC,
+	KDFOpts: pkcs8.ScryptOpts{
+		SaltSize:                 16,
+		CostParameter:            1 << 14,
+		BlockSize:                8,
+		ParallelizationParameter: 1,
+	},
+}
+
+// MarshalEncryptedText marshals the key to a PEM encoded encrypted PKCS #8, ASN.1 DER form.
+// The key is encrypted with PBES2, using scrypt to derive an AES-256 key from passphrase.
+func (p PrivateKey) MarshalEncryptedText(passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("bifrost: empty passphrase")
+	}
+	keyDer, err := pkcs8.MarshalPrivateKey(p.PrivateKey, passphrase, encryptedKeyOpts)
+	if err != nil {
+		return nil, fmt.Errorf("bifrost: error encrypting private key: %w", err)
+	}
+	block := &pem.Block{
+		Type:  pemTypeEncryptedPrivateKey,
+		Bytes: keyDer,
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// UnmarshalEncryptedText unmarshals the private key from a PEM encoded
+// encrypted PKCS #8, ASN.1 DER form, decrypting it with passphrase.
+// PBES2 keys using PBKDF2 or scrypt, with AES-CBC or AES-GCM ciphers are supported.
+// Unencrypted PEM blocks are unmarshaled as if by UnmarshalText.
+func (p *PrivateKey) UnmarshalEncryptedText(text, passphrase []byte) error {
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return errors.New("bifrost: invalid PEM block")
+	}
+	if block.Type != pemTypeEncryptedPrivateKey {
+		return p.UnmarshalText(text)
+	}
+	if len(passphrase) == 0 {
+		return ErrPrivateKeyEncrypted
+	}
+	priv, _, err := pkcs8.ParsePrivateKey(block.Bytes, passphrase)
+	if err != nil {
+		return fmt.Errorf("bifrost: error decrypting private key: %w", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	return p.UnmarshalBinary(keyDer)
+}
+
 // MarshalJSON marshals the key to a JSON string containing PEM encoded PKCS #8, ASN.1 DER form.
 func (p PrivateKey) MarshalJSON() ([]byte, error) {
 	keyText, err := p.MarshalText()
@@ -256,15 +465,101 @@ func (p PrivateKey) UUID(ns uuid.UUID) uuid.UUID {
 }
 
 // UUID returns a unique identifier derived from the namespace and the client's public key identity.
-// The UUID is generated by SHA-1 hashing the namesapce UUID
-// with the big endian bytes of the X and Y curve points from the public key.
+// The UUID is a version 5 UUID generated by SHA-1 hashing the namespace UUID with
+// bytes that depend on the key type:
+//   - P-256 keys hash the big endian bytes of the X and Y curve points,
+//     each left padded to 32 bytes.
+//   - P-384 keys hash the ASCII string "P-384" followed by the big endian bytes
+//     of the X and Y curve points, each left padded to 48 bytes.
+//   - Ed25519 keys hash the ASCII string "Ed25519" followed by the 32 byte public key.
+//   - RSA keys hash the ASCII string "RSA" followed by the PKIX, ASN.1 DER encoded
+//     SubjectPublicKeyInfo of the key.
+//
+// Key types other than P-256 are prefixed with their name so that inputs of
+// different key types never coincide and cannot collide with P-256 identities.
+// UUID returns [uuid.Nil] if ns is nil or the key type is unsupported.
 func UUID(ns uuid.UUID, pubkey *PublicKey) uuid.UUID {
-	if ns == uuid.Nil {
+	if ns == uuid.Nil || pubkey == nil {
 		return uuid.Nil
 	}
-	// X and Y are guaranteed to by 256 bits (32 bytes) each for elliptic curve P256 keys.
-	var buf [64]byte
-	pubkey.X.FillBytes(buf[:32])
-	pubkey.Y.FillBytes(buf[32:])
-	return uuid.NewSHA1(ns, buf[:])
+	switch k := pubkey.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			// X and Y are guaranteed to by 256 bits (32 bytes) each for elliptic curve P256 keys.
+			var buf [64]byte
+			k.X.FillBytes(buf[:32])
+			k.Y.FillBytes(buf[32:])
+			return uuid.NewSHA1(ns, buf[:])
+		case elliptic.P384():
+			// X and Y are guaranteed to by 384 bits (48 bytes) each for elliptic curve P384 keys.
+			var buf [len(uuidPrefixP384) + 96]byte
+			n := copy(buf[:], uuidPrefixP384)
+			k.X.FillBytes(buf[n : n+48])
+			k.Y.FillBytes(buf[n+48:])
+			return uuid.NewSHA1(ns, buf[:])
+		default:
+			return uuid.Nil
+		}
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return uuid.Nil
+		}
+		return uuid.NewSHA1(ns, append([]byte(uuidPrefixEd25519), k...))
+	case *rsa.PublicKey:
+		spki, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return uuid.Nil
+		}
+		return uuid.NewSHA1(ns, append([]byte(uuidPrefixRSA), spki...))
+	default:
+		return uuid.Nil
+	}
+}
+
+// UUID derivation prefixes.
+const (
+	uuidPrefixP384    = "P-384"
+	uuidPrefixEd25519 = "Ed25519"
+	uuidPrefixRSA     = "RSA"
+)
+
+// errLegacyRSA is returned for RSA keys parsed without [AllowLegacyRSA].
+var errLegacyRSA = errors.New("bifrost: legacy RSA keys are not allowed")
+
+// checkKey returns an error if pub is not a supported identity key,
+// or is a legacy RSA key and o does not allow them.
+func (o *parseOptions) checkKey(pub crypto.PublicKey) error {
+	kt, err := publicKeyType(pub)
+	if err != nil {
+		return err
+	}
+	if kt == KeyTypeRSA && !o.allowRSA {
+		return errLegacyRSA
+	}
+	return nil
+}
+
+// publicKeyType returns the bifrost key type of pub,
+// or an error if pub is not a supported identity key.
+func publicKeyType(pub crypto.PublicKey) (KeyType, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyTypeP256, nil
+		case elliptic.P384():
+			return KeyTypeP384, nil
+		}
+		return "", fmt.Errorf("bifrost: unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return KeyTypeEd25519, nil
+	case *rsa.PublicKey:
+		if size := k.N.BitLen(); size < MinimumRSAKeySize {
+			return "", fmt.Errorf("bifrost: RSA key size %d is too small", size)
+		}
+		return KeyTypeRSA, nil
+	default:
+		return "", fmt.Errorf("bifrost: unexpected key type %T", pub)
+	}
 }
@@ -0,0 +1,287 @@
+package bifrost
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRenewalWindow is the fraction of the certificate lifetime remaining when
+// client certificates are renewed.
+const DefaultRenewalWindow = 1.0 / 3
+
+// Delays between retries of failed background renewals.
+const (
+	renewRetryBaseDelay = time.Second
+	renewRetryMaxDelay  = time.Minute
+)
+
+type renewalOptions struct {
+	window     float64
+	background bool
+	onRenew    func([]*Certificate)
+	onError    func(error)
+	store      CertificateStore
+}
+
+// certRefresher gets client certificates from a bifrost CA and renews them before they expire.
+// With background renewal, renewals are scheduled once the renewal window opens,
+// and retried with backoff if they fail, until ctx is done.
+// Otherwise, and after ctx is done, renewals start when a handshake finds the
+// certificate in its renewal window.
+// TLS handshakes use the current certificate while it is valid, and only wait for
+// the CA when there is no valid certificate.
+// Concurrent requests for a certificate share a single request to the CA.
+// With a CertificateStore, a valid stored certificate is used before asking the CA,
+// and issued certificates are stored.
+type certRefresher struct {
+	ctx     context.Context
+	ca      *CAClient
+	privkey *PrivateKey
+	opts    renewalOptions
+	cert    atomic.Pointer[tls.Certificate]
+
+	// ns is the namespace of the CA, from ca.Namespace, a stored certificate, or the CA.
+	// It is only used by run, and renewals never run concurrently.
+	ns uuid.UUID
+
+	mu       sync.Mutex
+	inflight *renewal
+	timer    *time.Timer
+	failures int
+}
+
+// renewal is a request for a certificate to the CA.
+// done is closed when the request completes.
+type renewal struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+func newCertRefresher(
+	ctx context.Context,
+	ca *CAClient,
+	privkey *PrivateKey,
+	opts renewalOptions,
+) *certRefresher {
+	if opts.window <= 0 || opts.window >= 1 {
+		opts.window = DefaultRenewalWindow
+	}
+	cr := &certRefresher{
+		ctx:     ctx,
+		ca:      ca,
+		privkey: privkey,
+		opts:    opts,
+		ns:      ca.Namespace,
+	}
+	if opts.background {
+		// Release the timer, and with it the refresher and its key, when ctx is done.
+		context.AfterFunc(ctx, func() {
+			cr.mu.Lock()
+			defer cr.mu.Unlock()
+			if cr.timer != nil {
+				cr.timer.Stop()
+				cr.timer = nil
+			}
+		})
+	}
+	return cr
+}
+
+func (cr *certRefresher) getClientCertificate(
+	info *tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+	ctx := context.Background()
+	if info != nil {
+		ctx = info.Context()
+	}
+	tlsCert, err := cr.clientCertificate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		if err := info.SupportsCertificate(tlsCert); err != nil {
+			return nil, err
+		}
+	}
+	return tlsCert, nil
+}
+
+// clientCertificate returns the current certificate, waiting for a new one until ctx is done
+// if there is no valid certificate.
+func (cr *certRefresher) clientCertificate(ctx context.Context) (*tls.Certificate, error) {
+	tlsCert := cr.cert.Load()
+	now := time.Now()
+	switch {
+	case tlsCert == nil || !now.Before(tlsCert.Leaf.NotAfter):
+		// There is no valid certificate to use, wait for a new one.
+		r := cr.renew()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		tlsCert = r.cert
+	case !now.Before(cr.renewAt(tlsCert.Leaf.NotBefore, tlsCert.Leaf.NotAfter)):
+		// Use the current certificate while it is renewed.
+		// This catches up if background renewal is stopped or running late.
+		cr.renew()
+	}
+	return tlsCert, nil
+}
+
+// renewAt returns when a certificate valid from notBefore to notAfter should be renewed.
+func (cr *certRefresher) renewAt(notBefore, notAfter time.Time) time.Time {
+	lifetime := notAfter.Sub(notBefore)
+	return notAfter.Add(-time.Duration(float64(lifetime) * cr.opts.window))
+}
+
+// renew returns the in-flight renewal, starting one if there is none.
+func (cr *certRefresher) renew() *renewal {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.inflight != nil {
+		return cr.inflight
+	}
+	r := &renewal{done: make(chan struct{})}
+	cr.inflight = r
+	go cr.run(r)
+	return r
+}
+
+func (cr *certRefresher) run(r *renewal) {
+	// Renewals are shared by every waiting handshake, so they must not be
+	// cancelled along with any one of them, or by stopping background renewal.
+	ctx := context.WithoutCancel(cr.ctx)
+	Logger().DebugContext(ctx, "refreshing client certificate")
+
+	// Start with a stored certificate if there is a valid one.
+	var chain []*Certificate
+	var err error
+	loaded := false
+	if cr.cert.Load() == nil && cr.opts.store != nil {
+		chain = cr.loadStored(ctx)
+		loaded = chain != nil
+	}
+	if chain == nil {
+		start := time.Now()
+		chain, err = cr.request(ctx)
+		StatsForNerds.GetOrCreateHistogram("bifrost_client_certificate_renewal_duration_seconds").
+			UpdateDuration(start)
+		if err == nil && cr.opts.store != nil {
+			if err := cr.opts.store.StoreCertificate(ctx, chain); err != nil {
+				Logger().WarnContext(ctx, "error storing client certificate", "error", err)
+			}
+		}
+	}
+
+	if err == nil {
+		// Send intermediate CA certificates along with the client certificate.
+		r.cert = X509ToTLSCertificate(chain[0].Certificate, cr.privkey.PrivateKey)
+		for _, c := range chain[1:] {
+			r.cert.Certificate = append(r.cert.Certificate, c.Raw)
+		}
+		cr.cert.Store(r.cert)
+	}
+	r.err = err
+
+	cr.mu.Lock()
+	cr.inflight = nil
+	if err == nil {
+		cr.failures = 0
+		cr.schedule(time.Until(cr.renewAt(r.cert.Leaf.NotBefore, r.cert.Leaf.NotAfter)))
+	} else if cr.cert.Load() != nil {
+		// Keep using the current certificate and try again later.
+		cr.failures++
+		retry := RetryPolicy{BaseDelay: renewRetryBaseDelay, MaxDelay: renewRetryMaxDelay}
+		cr.schedule(retry.delay(cr.failures, "", time.Now()))
+	}
+	cr.mu.Unlock()
+	close(r.done)
+
+	if err != nil {
+		StatsForNerds.GetOrCreateCounter(
+			`bifrost_client_certificate_renewals_total{result="error"}`).Inc()
+		Logger().ErrorContext(ctx, "error renewing client certificate", "error", err)
+		if cr.opts.onError != nil {
+			cr.opts.onError(err)
+		}
+		return
+	}
+
+	if loaded {
+		StatsForNerds.GetOrCreateCounter("bifrost_client_certificate_loads_total").Inc()
+		Logger().InfoContext(ctx, "loaded stored client certificate",
+			"namespace", chain[0].Namespace, "uuid", chain[0].ID, "notAfter", chain[0].NotAfter)
+		return
+	}
+
+	StatsForNerds.GetOrCreateCounter(
+		`bifrost_client_certificate_renewals_total{result="success"}`).Inc()
+	Logger().InfoContext(ctx, "got new client certificate",
+		"namespace", chain[0].Namespace, "uuid", chain[0].ID, "notAfter", chain[0].NotAfter)
+	if cr.opts.onRenew != nil {
+		cr.opts.onRenew(chain)
+	}
+}
+
+// request requests a certificate chain from the CA, asking the CA for its namespace
+// only if it is not known yet.
+func (cr *certRefresher) request(ctx context.Context) ([]*Certificate, error) {
+	if cr.ns == uuid.Nil {
+		ns, err := cr.ca.namespace(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cr.ns = ns
+	}
+	// Copy the CAClient, which the caller may share with other clients.
+	ca := *cr.ca
+	ca.Namespace = cr.ns
+	return ca.RequestCertificateChain(ctx, cr.privkey)
+}
+
+// loadStored returns the stored certificate chain for the private key,
+// or nil if there is none, it has expired, or it is from another namespace.
+// The namespace of a loaded certificate is used for later requests,
+// so that clients with a valid stored certificate start without contacting the CA.
+func (cr *certRefresher) loadStored(ctx context.Context) []*Certificate {
+	chain, err := cr.opts.store.LoadCertificate(ctx, cr.privkey.PublicKey())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			Logger().WarnContext(ctx, "error loading stored client certificate", "error", err)
+		}
+		return nil
+	}
+	now := time.Now()
+	leaf := chain[0]
+	if !leaf.IssuedTo(cr.privkey.PublicKey()) ||
+		now.Before(leaf.NotBefore) || !now.Before(leaf.NotAfter) ||
+		(cr.ns != uuid.Nil && leaf.Namespace != cr.ns) {
+		return nil
+	}
+	cr.ns = leaf.Namespace
+	return chain
+}
+
+// schedule starts a background renewal after d, replacing any scheduled renewal.
+// cr.mu must be held.
+func (cr *certRefresher) schedule(d time.Duration) {
+	if !cr.opts.background || cr.ctx.Err() != nil {
+		return
+	}
+	if cr.timer != nil {
+		cr.timer.Stop()
+	}
+	cr.timer = time.AfterFunc(d, func() { cr.renew() })
+}
@@ -0,0 +1,243 @@
+package bifrost
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testCAServer issues certificates valid for lifetime, and fails requests while failing is set.
+// It counts every request, and issued certificates.
+type testCAServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	issued   atomic.Int32
+	failing  atomic.Bool
+}
+
+func newTestCAServer(t *testing.T, lifetime time.Duration) *testCAServer {
+	t.Helper()
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	caKey, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:   caKey.UUID(ns).String(),
+			Organization: []string{ns.String()},
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testCAServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		switch r.URL.Path {
+		case "/namespace":
+			fmt.Fprint(w, ns)
+		case "/issue":
+			if s.failing.Load() {
+				http.Error(w, "gauntlet timed out", http.StatusServiceUnavailable)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			csr, err := x509.ParseCertificateRequest(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			now := time.Now()
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(int64(s.issued.Add(1)) + 1),
+				Subject:      csr.Subject,
+				NotBefore:    now,
+				NotAfter:     now.Add(lifetime),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(der)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCertRefresher_background(t *testing.T) {
+	// Certificate times are truncated to seconds, so lifetimes are a few seconds long.
+	ca := newTestCAServer(t, 4*time.Second)
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	renewed := make(chan []*Certificate, 10)
+	failed := make(chan error, 10)
+	o := newClientOptions(ca.URL, []ClientOption{
+		WithRenewalWindow(0.5),
+		OnRenew(func(chain []*Certificate) { renewed <- chain }),
+		OnError(func(err error) { failed <- err }),
+	})
+	o.renewal.background = true
+	tlsConfig, err := o.tlsConfig(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-renewed
+	if !first[0].PublicKey.Equal(key.PublicKey()) {
+		t.Fatal("issued certificate does not match key")
+	}
+
+	// The certificate is renewed halfway through its lifetime, without a handshake.
+	select {
+	case chain := <-renewed:
+		if !chain[0].NotAfter.After(first[0].NotAfter) {
+			t.Fatal("expected a newer certificate")
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("certificate was not renewed in the background")
+	}
+	cert, err := tlsConfig.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.SerialNumber.Int64() == first[0].SerialNumber.Int64() {
+		t.Fatal("handshake got the old certificate")
+	}
+
+	// Failed renewals are retried while the current certificate is used.
+	ca.failing.Store(true)
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrRequestAborted) {
+			t.Fatalf("expected ErrRequestAborted, got %v", err)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("expected a failed renewal")
+	}
+	if got, err := tlsConfig.GetClientCertificate(nil); err != nil || got != cert {
+		t.Fatalf("expected the current certificate, got %v", err)
+	}
+	ca.failing.Store(false)
+	select {
+	case <-renewed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("renewal was not retried")
+	}
+
+	// Background renewal stops when its context is done.
+	cancel()
+	select {
+	case <-renewed:
+		t.Fatal("certificate was renewed after the context was cancelled")
+	case <-time.After(3 * time.Second):
+	}
+}
+
+func TestCertRefresher_noBackground(t *testing.T) {
+	ca := newTestCAServer(t, 4*time.Second)
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed := make(chan []*Certificate, 10)
+	cr := newCertRefresher(context.Background(), &CAClient{URL: ca.URL}, key, renewalOptions{
+		window:  0.5,
+		onRenew: func(chain []*Certificate) { renewed <- chain },
+	})
+	if _, err := cr.getClientCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+	<-renewed
+
+	// Without background renewal, no timer is left running.
+	cr.mu.Lock()
+	timer := cr.timer
+	cr.mu.Unlock()
+	if timer != nil {
+		t.Fatal("expected no renewal timer")
+	}
+	select {
+	case <-renewed:
+		t.Fatal("certificate was renewed in the background")
+	case <-time.After(3 * time.Second):
+	}
+
+	// Handshakes renew the certificate once the renewal window opens.
+	if _, err := cr.getClientCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-renewed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("certificate was not renewed by a handshake")
+	}
+}
+
+func TestCertRefresher_dedup(t *testing.T) {
+	ca := newTestCAServer(t, time.Hour)
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := newCertRefresher(context.Background(), &CAClient{URL: ca.URL}, key, renewalOptions{})
+	var wg sync.WaitGroup
+	certs := make([]*tls.Certificate, 20)
+	for i := range certs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cert, err := cr.getClientCertificate(nil)
+			if err != nil {
+				t.Error(err)
+			}
+			certs[i] = cert
+		}()
+	}
+	wg.Wait()
+
+	if n := ca.issued.Load(); n != 1 {
+		t.Fatalf("got %d certificate requests, want 1", n)
+	}
+	for _, c := range certs {
+		if c != certs[0] {
+			t.Fatal("expected every handshake to get the same certificate")
+		}
+	}
+}
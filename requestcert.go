@@ -6,9 +6,11 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/google/uuid"
@@ -21,7 +23,7 @@ func CertificateRequestTemplate(ns uuid.UUID, key *PublicKey) *x509.CertificateR
 			CommonName:   key.UUID(ns).String(),
 			Organization: []string{ns.String()},
 		},
-		SignatureAlgorithm: SignatureAlgorithm,
+		SignatureAlgorithm: key.SignatureAlgorithm(),
 	}
 }
 
@@ -29,37 +31,82 @@ func CertificateRequestTemplate(ns uuid.UUID, key *PublicKey) *x509.CertificateR
 // The returned error wraps ErrCertificateRequestInvalid or ErrCertificateRequestDenied
 // if the request is invalid or denied.
 func RequestCertificate(ctx context.Context, caUrl string, key *PrivateKey) (*Certificate, error) {
-	namespace, err := GetNamespace(ctx, caUrl)
-	if err != nil {
-		return nil, fmt.Errorf("bifrost: error getting namespace: %w", err)
-	}
+	return (&CAClient{URL: caUrl}).RequestCertificate(ctx, key)
+}
 
-	template := CertificateRequestTemplate(namespace, key.PublicKey())
-	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+// RequestCertificateChain is like [RequestCertificate] but also returns the chain of
+// intermediate CA certificates sent by the CA, the signed certificate first.
+func RequestCertificateChain(ctx context.Context, caUrl string, key *PrivateKey) ([]*Certificate, error) {
+	return (&CAClient{URL: caUrl}).RequestCertificateChain(ctx, key)
+}
+
+// GetNamespace returns the namespace from the CA at url.
+func GetNamespace(ctx context.Context, caUrl string) (uuid.UUID, error) {
+	return (&CAClient{URL: caUrl}).GetNamespace(ctx)
+}
+
+// CAClient sends requests to a bifrost CA.
+type CAClient struct {
+	// URL is the base URL of the CA.
+	URL string
+
+	// HTTPClient sends requests to the CA. If nil, http.DefaultClient is used.
+	// Set a client to use proxies, TLS roots, or timeouts for CA requests.
+	HTTPClient *http.Client
+
+	// Retry retries requests that the CA could not serve.
+	// The zero value does not retry.
+	Retry RetryPolicy
+
+	// Namespace is the namespace of the CA.
+	// If set, certificate requests use it instead of asking the CA.
+	Namespace uuid.UUID
+}
+
+// RequestCertificate sends a certificate request for key to the CA and returns the
+// signed certificate.
+// The returned error wraps ErrCertificateRequestInvalid or ErrCertificateRequestDenied
+// if the request is invalid or denied.
+func (c *CAClient) RequestCertificate(ctx context.Context, key *PrivateKey) (*Certificate, error) {
+	chain, err := c.RequestCertificateChain(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("bifrost: error creating certificate request: %w", err)
+		return nil, err
 	}
+	return chain[0], nil
+}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		caUrl+"/issue",
-		bytes.NewReader(csr),
-	)
+// RequestCertificateChain is like [CAClient.RequestCertificate] but also returns the chain of
+// intermediate CA certificates sent by the CA, the signed certificate first.
+func (c *CAClient) RequestCertificateChain(
+	ctx context.Context,
+	key *PrivateKey,
+) ([]*Certificate, error) {
+	namespace, err := c.namespace(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("bifrost: error creating request: %w", err)
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/octet-stream")
 
-	resp, err := http.DefaultClient.Do(req)
+	template := CertificateRequestTemplate(namespace, key.PublicKey())
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
 	if err != nil {
-		return nil, fmt.Errorf("bifrost: error sending request: %w", err)
+		return nil, fmt.Errorf("bifrost: error creating certificate request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, body, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			c.URL+"/issue",
+			bytes.NewReader(csr),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("bifrost: unexpected error reading response body: %w", err)
+		return nil, err
 	}
 
 	switch resp.StatusCode {
@@ -78,37 +125,44 @@ func RequestCertificate(ctx context.Context, caUrl string, key *PrivateKey) (*Ce
 		)
 	}
 
-	cert, err := ParseCertificate(body)
+	certs, err := x509.ParseCertificates(body)
 	if err != nil {
 		return nil, fmt.Errorf("bifrost: error parsing certificate: %w", err)
 	}
+	if len(certs) == 0 {
+		return nil, errors.New("bifrost: no certificate in response")
+	}
+	chain := make([]*Certificate, 0, len(certs))
+	for _, c := range certs {
+		cert, err := NewCertificate(c)
+		if err != nil {
+			return nil, fmt.Errorf("bifrost: error parsing certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
 
 	metrics.GetOrCreateCounter(
 		fmt.Sprintf(`bifrost_certificate_requests_total{namespace="%s"}`, namespace),
 	).Inc()
 
-	return cert, nil
+	return chain, nil
 }
 
-// GetNamespace returns the namespace from the CA at url.
-func GetNamespace(ctx context.Context, caUrl string) (uuid.UUID, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, caUrl+"/namespace", nil)
+// GetNamespace returns the namespace of the CA.
+func (c *CAClient) GetNamespace(ctx context.Context) (uuid.UUID, error) {
+	resp, body, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/namespace", nil)
+	})
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("bifrost: error creating request: %w", err)
+		return uuid.Nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("bifrost: error sending request: %w", err)
-	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
 		return uuid.Nil, fmt.Errorf("bifrost: unexpected response status: %s", resp.Status)
 	}
 
 	var nss string
-	if _, err := fmt.Fscan(resp.Body, &nss); err != nil {
+	if _, err := fmt.Fscan(bytes.NewReader(body), &nss); err != nil {
 		return uuid.Nil, fmt.Errorf("bifrost: error reading response body: %w", err)
 	}
 
@@ -119,3 +173,67 @@ func GetNamespace(ctx context.Context, caUrl string) (uuid.UUID, error) {
 
 	return ns, nil
 }
+
+// namespace returns c.Namespace if it is set, or gets the namespace from the CA.
+func (c *CAClient) namespace(ctx context.Context) (uuid.UUID, error) {
+	if c.Namespace != uuid.Nil {
+		return c.Namespace, nil
+	}
+	ns, err := c.GetNamespace(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("bifrost: error getting namespace: %w", err)
+	}
+	return ns, nil
+}
+
+// do sends the request made by newReq, retrying as set by c.Retry,
+// and returns the last response along with its body.
+func (c *CAClient) do(
+	ctx context.Context,
+	newReq func() (*http.Request, error),
+) (*http.Response, []byte, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, nil, fmt.Errorf("bifrost: error creating request: %w", err)
+		}
+
+		var delay time.Duration
+		resp, err := client.Do(req)
+		if err != nil {
+			// Requests that could not be sent are retried, unless the caller gave up.
+			err = fmt.Errorf("bifrost: error sending request: %w", err)
+			if ctx.Err() != nil || attempt >= c.Retry.MaxAttempts {
+				return nil, nil, err
+			}
+			delay = c.Retry.delay(attempt, "", time.Now())
+			Logger().DebugContext(ctx, "retrying CA request",
+				"url", req.URL.String(), "error", err, "attempt", attempt, "delay", delay)
+		} else {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, nil, fmt.Errorf("bifrost: unexpected error reading response body: %w", err)
+			}
+
+			if !retryable(resp.StatusCode) || attempt >= c.Retry.MaxAttempts {
+				return resp, body, nil
+			}
+
+			delay = c.Retry.delay(attempt, resp.Header.Get("Retry-After"), time.Now())
+			Logger().DebugContext(ctx, "retrying CA request",
+				"url", req.URL.String(), "status", resp.Status, "attempt", attempt, "delay", delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("bifrost: error sending request: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
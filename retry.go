@@ -0,0 +1,77 @@
+package bifrost
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default retry delays used when a [RetryPolicy] does not set them.
+const (
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = 10 * time.Second
+)
+
+// RetryPolicy configures retries of requests to a bifrost CA.
+// Requests are retried when they cannot be sent or get no response, and when the CA
+// responds with a 5xx status, which includes requests aborted by the gauntlet
+// ([ErrRequestAborted]), or with 429 Too Many Requests.
+//
+// Retries wait for an exponentially increasing delay with full jitter,
+// unless the CA sends a Retry-After header, which is honored instead up to MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, doubled for every retry after it.
+	// Defaults to DefaultRetryBaseDelay.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries, including delays asked for with Retry-After.
+	// Defaults to DefaultRetryMaxDelay.
+	MaxDelay time.Duration
+}
+
+func retryable(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// delay returns how long to wait before retrying after the attempt-th attempt failed.
+// retryAfter is the value of the Retry-After response header, if any.
+func (p RetryPolicy) delay(attempt int, retryAfter string, now time.Time) time.Duration {
+	base, maxDelay := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	if d, ok := parseRetryAfter(retryAfter, now); ok {
+		return min(d, maxDelay)
+	}
+
+	backoff := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift > 0 && base<<shift < maxDelay {
+		backoff = base << shift
+	}
+	return rand.N(backoff + 1)
+}
+
+// parseRetryAfter parses a Retry-After header value, either delay seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
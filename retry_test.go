@@ -0,0 +1,158 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCAClient_retry(t *testing.T) {
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+
+	var nsCalls, issueCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/namespace":
+			if nsCalls.Add(1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, ns)
+		case "/issue":
+			issueCalls.Add(1)
+			http.Error(w, "gauntlet timed out", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ca := &CAClient{
+		URL:   srv.URL,
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	}
+	got, err := ca.GetNamespace(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ns || nsCalls.Load() != 3 {
+		t.Fatalf("got namespace %s after %d calls, want %s after 3", got, nsCalls.Load(), ns)
+	}
+
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ca.RequestCertificateChain(context.Background(), key)
+	if !errors.Is(err, ErrRequestAborted) {
+		t.Fatalf("expected ErrRequestAborted, got %v", err)
+	}
+	if n := issueCalls.Load(); n != 3 {
+		t.Fatalf("got %d issue calls, want 3", n)
+	}
+
+	// Without retries the first failure is returned.
+	nsCalls.Store(0)
+	if _, err := (&CAClient{URL: srv.URL}).GetNamespace(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Waiting for a retry stops when the context is done.
+	nsCalls.Store(0)
+	ca.Retry.BaseDelay = time.Hour
+	ca.Retry.MaxDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	if _, err := ca.GetNamespace(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCAClient_retryTransportError(t *testing.T) {
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ns)
+	}))
+	defer srv.Close()
+
+	// The first attempts fail to connect, as if the CA were down.
+	var calls atomic.Int32
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if calls.Add(1) < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	ca := &CAClient{
+		URL:        srv.URL,
+		HTTPClient: &http.Client{Transport: transport},
+		Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	}
+	got, err := ca.GetNamespace(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ns || calls.Load() != 3 {
+		t.Fatalf("got namespace %s after %d calls, want %s after 3", got, calls.Load(), ns)
+	}
+
+	// The last error is returned when attempts run out.
+	calls.Store(-10)
+	if _, err := ca.GetNamespace(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if n := calls.Load(); n != -7 {
+		t.Fatalf("got %d calls, want 3", n+10)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryPolicy_delay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 1; attempt < 100; attempt++ {
+		want := min(p.BaseDelay<<min(attempt-1, 10), p.MaxDelay)
+		if d := p.delay(attempt, "", now); d < 0 || d > want {
+			t.Fatalf("attempt %d: got delay %s, want at most %s", attempt, d, want)
+		}
+	}
+
+	// Retry-After is honored up to MaxDelay.
+	p.MaxDelay = 2 * time.Minute
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"86400", 2 * time.Minute},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(time.Hour).Format(http.TimeFormat), 2 * time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tc := range tests {
+		if d := p.delay(1, tc.retryAfter, now); d != tc.want {
+			t.Errorf("Retry-After %q: got %s, want %s", tc.retryAfter, d, tc.want)
+		}
+	}
+
+	for _, v := range []string{"-1", "soon"} {
+		if d := p.delay(1, v, now); d > p.BaseDelay {
+			t.Errorf("Retry-After %q: got %s, want backoff", v, d)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// URI SAN schemes that carry bifrost identities.
+const (
+	schemeSPIFFE  = "spiffe"
+	schemeURN     = "urn"
+	urnUUIDPrefix = "uuid:"
+)
+
+// SPIFFEID returns the SPIFFE ID of the bifrost identity id in namespace ns,
+// in the form spiffe://<trust-domain>/ns/<namespace>/id/<uuid>.
+// trustDomain must be a valid SPIFFE trust domain name,
+// made up of lowercase letters, digits, dots, dashes, and underscores.
+func SPIFFEID(trustDomain string, ns, id uuid.UUID) (*url.URL, error) {
+	if err := validateTrustDomain(trustDomain); err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Scheme: schemeSPIFFE,
+		Host:   trustDomain,
+		Path:   "/ns/" + ns.String() + "/id/" + id.String(),
+	}, nil
+}
+
+// UUIDURN returns the RFC 9562 URN of id, urn:uuid:<uuid>.
+func UUIDURN(id uuid.UUID) *url.URL {
+	return &url.URL{Scheme: schemeURN, Opaque: urnUUIDPrefix + id.String()}
+}
+
+// TrustDomains maps SPIFFE trust domain names to bifrost namespaces.
+type TrustDomains map[string]uuid.UUID
+
+// ParseTrustDomains parses a comma separated list of trust-domain=namespace pairs.
+//
+//	example.org=80485314-6c73-40ff-86c5-a5942a0f514f,staging.example.org=...
+func ParseTrustDomains(s string) (TrustDomains, error) {
+	td := make(TrustDomains)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, rawNS, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("bifrost: invalid trust domain mapping %q", pair)
+		}
+		if err := validateTrustDomain(name); err != nil {
+			return nil, err
+		}
+		ns, err := uuid.Parse(rawNS)
+		if err != nil {
+			return nil, fmt.Errorf("bifrost: invalid namespace for trust domain %s: %w", name, err)
+		}
+		td[name] = ns
+	}
+	return td, nil
+}
+
+// Namespace returns the namespace mapped to trustDomain.
+func (td TrustDomains) Namespace(trustDomain string) (uuid.UUID, bool) {
+	ns, ok := td[trustDomain]
+	return ns, ok
+}
+
+// TrustDomain returns a trust domain mapped to ns.
+// If more than one trust domain maps to ns, the first one in lexical order is returned.
+func (td TrustDomains) TrustDomain(ns uuid.UUID) (string, bool) {
+	var found string
+	for name, n := range td {
+		if n == ns && (found == "" || name < found) {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+// WithTrustDomains returns a ParseOption that only accepts SPIFFE IDs from
+// trust domains in td, and requires the namespace in each SPIFFE ID to be the
+// namespace mapped to its trust domain.
+func WithTrustDomains(td TrustDomains) ParseOption {
+	return func(o *parseOptions) {
+		o.trustDomains = td
+	}
+}
+
+func validateTrustDomain(name string) error {
+	if name == "" {
+		return errors.New("bifrost: empty trust domain")
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return fmt.Errorf("bifrost: invalid character %q in trust domain %s", c, name)
+		}
+	}
+	return nil
+}
+
+// uriIdentity returns the namespace and identity in SPIFFE ID and urn:uuid URI SANs.
+// Other URIs are ignored. Either returned UUID is nil if no URI carries it.
+func (o *parseOptions) uriIdentity(uris []*url.URL) (uuid.UUID, uuid.UUID, error) {
+	var ns, id uuid.UUID
+	var spiffeSeen bool
+	setID := func(v uuid.UUID) error {
+		if id != uuid.Nil && id != v {
+			return fmt.Errorf("%w, conflicting URI SAN identities", ErrCertificateInvalid)
+		}
+		id = v
+		return nil
+	}
+
+	for _, u := range uris {
+		switch {
+		case u.Scheme == schemeSPIFFE:
+			if spiffeSeen {
+				return uuid.Nil, uuid.Nil, fmt.Errorf(
+					"%w, more than one SPIFFE ID", ErrCertificateInvalid)
+			}
+			spiffeSeen = true
+
+			sns, sid, err := o.parseSPIFFEID(u)
+			if err != nil {
+				return uuid.Nil, uuid.Nil, fmt.Errorf("%w, %w", ErrCertificateInvalid, err)
+			}
+			ns = sns
+			if err := setID(sid); err != nil {
+				return uuid.Nil, uuid.Nil, err
+			}
+		case u.Scheme == schemeURN && strings.HasPrefix(strings.ToLower(u.Opaque), urnUUIDPrefix):
+			uid, err := uuid.Parse(u.Opaque[len(urnUUIDPrefix):])
+			if err != nil {
+				return uuid.Nil, uuid.Nil, fmt.Errorf(
+					"%w, invalid UUID URN %s: %w", ErrCertificateInvalid, u, err)
+			}
+			if err := setID(uid); err != nil {
+				return uuid.Nil, uuid.Nil, err
+			}
+		}
+	}
+	return ns, id, nil
+}
+
+func (o *parseOptions) parseSPIFFEID(u *url.URL) (uuid.UUID, uuid.UUID, error) {
+	if err := validateTrustDomain(u.Host); err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid SPIFFE ID %s", u)
+	}
+
+	parts := strings.Split(u.Path, "/")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "ns" || parts[3] != "id" {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("SPIFFE ID %s is not a bifrost identity", u)
+	}
+	ns, err := uuid.Parse(parts[2])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid namespace in SPIFFE ID %s: %w", u, err)
+	}
+	id, err := uuid.Parse(parts[4])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid identity in SPIFFE ID %s: %w", u, err)
+	}
+
+	if o.trustDomains != nil {
+		tdNS, ok := o.trustDomains.Namespace(u.Host)
+		if !ok {
+			return uuid.Nil, uuid.Nil, fmt.Errorf("unknown trust domain %s", u.Host)
+		}
+		if tdNS != ns {
+			return uuid.Nil, uuid.Nil, fmt.Errorf(
+				"SPIFFE ID namespace %s does not match trust domain %s namespace %s",
+				ns, u.Host, tdNS)
+		}
+	}
+	return ns, id, nil
+}
@@ -0,0 +1,150 @@
+package bifrost
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSPIFFEID(t *testing.T) {
+	ns := uuid.MustParse("80485314-6c73-40ff-86c5-a5942a0f514f")
+	id := uuid.MustParse("0f9c2ac4-bd7f-5923-a785-a8bc4d8e2831")
+
+	u, err := SPIFFEID("example.org", ns, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "spiffe://example.org/ns/80485314-6c73-40ff-86c5-a5942a0f514f" +
+		"/id/0f9c2ac4-bd7f-5923-a785-a8bc4d8e2831"
+	if u.String() != want {
+		t.Fatalf("got %s, want %s", u, want)
+	}
+	if u := UUIDURN(id).String(); u != "urn:uuid:0f9c2ac4-bd7f-5923-a785-a8bc4d8e2831" {
+		t.Fatalf("got %s", u)
+	}
+
+	for _, td := range []string{"", "Example.org", "example.org:443", "exa mple"} {
+		if _, err := SPIFFEID(td, ns, id); err == nil {
+			t.Errorf("SPIFFEID(%q) expected error", td)
+		}
+	}
+}
+
+func TestParseTrustDomains(t *testing.T) {
+	ns1, ns2 := uuid.New(), uuid.New()
+	td, err := ParseTrustDomains("b.example.org=" + ns1.String() + ", a.example.org=" +
+		ns1.String() + ",other.org=" + ns2.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns, ok := td.Namespace("other.org"); !ok || ns != ns2 {
+		t.Fatalf("got %s %t, want %s", ns, ok, ns2)
+	}
+	if name, ok := td.TrustDomain(ns1); !ok || name != "a.example.org" {
+		t.Fatalf("got %s %t, want a.example.org", name, ok)
+	}
+	if _, ok := td.TrustDomain(uuid.New()); ok {
+		t.Fatal("expected no trust domain for unmapped namespace")
+	}
+
+	for _, in := range []string{"example.org", "example.org=nope", "EXAMPLE=" + ns1.String()} {
+		if _, err := ParseTrustDomains(in); err == nil {
+			t.Errorf("ParseTrustDomains(%q) expected error", in)
+		}
+	}
+}
+
+func TestNewCertificate_uriSANs(t *testing.T) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := uuid.New()
+	id := key.UUID(ns)
+	spiffeID, err := SPIFFEID("example.org", ns, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := SPIFFEID("example.org", ns, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherNS, err := SPIFFEID("example.org", uuid.New(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := url.Parse("spiffe://example.org/workload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, err := url.Parse("https://example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := pkix.Name{Organization: []string{ns.String()}, CommonName: id.String()}
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		uris    []*url.URL
+		opts    []ParseOption
+		err     bool
+	}{
+		{"subject and SANs", subject, []*url.URL{spiffeID, UUIDURN(id), web}, nil, false},
+		{"SPIFFE ID only", pkix.Name{}, []*url.URL{spiffeID}, nil, false},
+		{"UUID URN only", pkix.Name{}, []*url.URL{UUIDURN(id)}, nil, true},
+		{"identity mismatch", subject, []*url.URL{otherID}, nil, true},
+		{"namespace mismatch", subject, []*url.URL{otherNS}, nil, true},
+		{"URN mismatch", subject, []*url.URL{spiffeID, UUIDURN(uuid.New())}, nil, true},
+		{"two SPIFFE IDs", subject, []*url.URL{spiffeID, spiffeID}, nil, true},
+		{"foreign SPIFFE ID", subject, []*url.URL{foreign}, nil, true},
+		{
+			"mapped trust domain", pkix.Name{}, []*url.URL{spiffeID},
+			[]ParseOption{WithTrustDomains(TrustDomains{"example.org": ns})}, false,
+		},
+		{
+			"unknown trust domain", subject, []*url.URL{spiffeID},
+			[]ParseOption{WithTrustDomains(TrustDomains{"other.org": ns})}, true,
+		},
+		{
+			"trust domain namespace mismatch", subject, []*url.URL{spiffeID},
+			[]ParseOption{WithTrustDomains(TrustDomains{"example.org": uuid.New()})}, true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      tc.subject,
+				URIs:         tc.uris,
+				NotBefore:    time.Now(),
+				NotAfter:     time.Now().Add(time.Hour),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, err := ParseCertificate(der, tc.opts...)
+			if tc.err {
+				if !errors.Is(err, ErrCertificateInvalid) {
+					t.Fatalf("expected ErrCertificateInvalid, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.Namespace != ns || cert.ID != id {
+				t.Fatalf("got %s %s, want %s %s", cert.Namespace, cert.ID, ns, id)
+			}
+		})
+	}
+}
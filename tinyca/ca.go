@@ -10,7 +10,9 @@
 package tinyca
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
@@ -20,6 +22,9 @@ import (
 	"math"
 	"math/big"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/RealImage/bifrost"
@@ -36,13 +41,24 @@ const (
 
 // CA is a simple Certificate Authority.
 // The CA issues client certificates signed by a root certificate and private key.
+// The private key can be any [crypto.Signer], such as a key held in an HSM.
 // The CA provides an HTTP handler to issue certificates.
 // The CA also provides a [Gauntlet] function to customize the certificate template.
 // Call Stop to release resources when done.
 type CA struct {
-	cert *bifrost.Certificate
-	key  *bifrost.PrivateKey
-	gh   *gauntletThrower
+	cert   *bifrost.Certificate
+	key    crypto.Signer
+	sigAlg x509.SignatureAlgorithm
+	gh     *gauntletThrower
+
+	parseOpts []bifrost.ParseOption
+	// issuers link cert to a root, set by WithChain.
+	issuers []*bifrost.Certificate
+	// chain is sent along with issued certificates.
+	chain []*bifrost.Certificate
+	// URI SANs added to issued certificates.
+	trustDomain string
+	uuidURN     bool
 
 	// metrics
 	requests      *metrics.Counter
@@ -51,27 +67,84 @@ type CA struct {
 	issueSize     *metrics.Histogram
 }
 
+// Option configures optional CA behaviour.
+type Option func(*CA)
+
+// WithLegacyRSA returns an Option that lets the CA accept certificate requests
+// from legacy clients with RSA keys.
+// RSA identities are derived as documented in [bifrost.UUID].
+// Clients with RSA certificates must be verified with [bifrost.AllowLegacyRSA].
+func WithLegacyRSA() Option {
+	return func(ca *CA) {
+		ca.parseOpts = append(ca.parseOpts, bifrost.AllowLegacyRSA())
+	}
+}
+
+// WithChain returns an Option for CAs that sign with an intermediate CA certificate.
+// issuers are the certificates that link the CA certificate to its root,
+// starting with the issuer of the CA certificate.
+// The CA sends the CA certificate and issuers, except self-signed roots,
+// along with every certificate it issues.
+func WithChain(issuers ...*bifrost.Certificate) Option {
+	return func(ca *CA) {
+		ca.issuers = append(ca.issuers, issuers...)
+	}
+}
+
+// WithSPIFFEID returns an Option that adds a SPIFFE ID URI SAN,
+// spiffe://<trustDomain>/ns/<namespace>/id/<uuid>, to issued certificates.
+// Use [bifrost.WithTrustDomains] to check the trust domain when verifying certificates.
+func WithSPIFFEID(trustDomain string) Option {
+	return func(ca *CA) {
+		ca.trustDomain = trustDomain
+	}
+}
+
+// WithUUIDURN returns an Option that adds a urn:uuid:<uuid> URI SAN to issued certificates.
+func WithUUIDURN() Option {
+	return func(ca *CA) {
+		ca.uuidURN = true
+	}
+}
+
 // New returns a new Certificate Authority.
 // CA signs client certificates with the provided root certificate and private key.
+// key must be a [*bifrost.PrivateKey] or any [crypto.Signer] with a supported public key
+// that matches cert.
 // CA uses the provided gauntlet func to customise issued certificates.
 func New(
 	cert *bifrost.Certificate,
-	key *bifrost.PrivateKey,
+	key crypto.Signer,
 	gauntlet Gauntlet,
+	opts ...Option,
 ) (*CA, error) {
 	if !cert.IsCA() {
 		return nil, fmt.Errorf("bifrost: root certificate is not a valid CA")
 	}
 
+	// Bifrost certificates are only signed with ECDSA or Ed25519 keys,
+	// even when legacy RSA client keys are allowed.
+	pub := &bifrost.PublicKey{PublicKey: key.Public()}
+	sigAlg := pub.SignatureAlgorithm()
+	switch sigAlg {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.PureEd25519:
+	default:
+		return nil, fmt.Errorf("bifrost: unsupported CA key type %T", pub.PublicKey)
+	}
+	if !cert.IssuedTo(pub) {
+		return nil, fmt.Errorf("bifrost: CA certificate and key do not match")
+	}
+
 	reqs := bfMetricName("requests_total", cert.Namespace)
 	issued := bfMetricName("issued_certs_total", cert.Namespace)
 	issueDuration := bfMetricName("issue_duration_seconds", cert.Namespace)
 	issueSize := bfMetricName("issue_size_bytes", cert.Namespace)
 
 	ca := CA{
-		cert: cert,
-		key:  key,
-		gh:   newGauntletThrower(gauntlet, cert.Namespace),
+		cert:   cert,
+		key:    key,
+		sigAlg: sigAlg,
+		gh:     newGauntletThrower(gauntlet, cert.Namespace),
 
 		requests:      bifrost.StatsForNerds.GetOrCreateCounter(reqs),
 		issuedTotal:   bifrost.StatsForNerds.GetOrCreateCounter(issued),
@@ -79,9 +152,49 @@ func New(
 		issueSize:     bifrost.StatsForNerds.GetOrCreateHistogram(issueSize),
 	}
 
+	for _, opt := range opts {
+		opt(&ca)
+	}
+
+	if err := ca.buildChain(); err != nil {
+		return nil, err
+	}
+	if _, err := ca.identityURIs(cert.ID); err != nil {
+		return nil, err
+	}
+
 	return &ca, nil
 }
 
+// buildChain checks that each certificate in the chain is signed by the next
+// and sets the certificates sent with issued certificates.
+func (ca *CA) buildChain() error {
+	cert := ca.cert
+	if !isSelfSigned(cert) {
+		ca.chain = append(ca.chain, cert)
+	}
+	for _, issuer := range ca.issuers {
+		if issuer.Namespace != ca.cert.Namespace {
+			return fmt.Errorf("bifrost: CA chain namespace %s does not match %s",
+				issuer.Namespace, ca.cert.Namespace)
+		}
+		if err := cert.CheckSignatureFrom(issuer.Certificate); err != nil {
+			return fmt.Errorf("bifrost: invalid CA chain: %w", err)
+		}
+		if !isSelfSigned(issuer) {
+			ca.chain = append(ca.chain, issuer)
+		}
+		cert = issuer
+	}
+	return nil
+}
+
+// Chain returns the CA certificates sent along with issued certificates.
+// Chain is empty if the CA signs with a root certificate.
+func (ca *CA) Chain() []*bifrost.Certificate {
+	return ca.chain
+}
+
 // ServeHTTP issues a certificate if a valid certificate request is read from the request.
 //
 // Requests carrying a content-type of "text/plain" should have a PEM encoded certificate request.
@@ -157,9 +270,19 @@ func (ca *CA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case webapp.MimeTypeAll, webapp.MimeTypeText:
 		w.Header().Set(webapp.HeaderNameContentType, webapp.MimeTypeTextCharset)
 		err = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
+		for _, c := range ca.chain {
+			if err == nil {
+				err = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+			}
+		}
 	case webapp.MimeTypeBytes:
 		w.Header().Set(webapp.HeaderNameContentType, webapp.MimeTypeBytes)
-		_, err = w.Write(cert)
+		// Concatenated DER certificates can be parsed with x509.ParseCertificates.
+		for _, c := range append([][]byte{cert}, ca.rawChain()...) {
+			if err == nil {
+				_, err = w.Write(c)
+			}
+		}
 	default:
 		msg := fmt.Sprintf("media type %s unacceptable", responseType)
 		http.Error(w, msg, http.StatusNotAcceptable)
@@ -191,7 +314,7 @@ func (ca *CA) AddRoutes(mux *http.ServeMux, metrics bool) {
 func (ca *CA) IssueCertificate(asn1CSR []byte, notBefore, notAfter time.Time) ([]byte, error) {
 	issueStart := time.Now()
 
-	csr, err := bifrost.ParseCertificateRequest(asn1CSR)
+	csr, err := bifrost.ParseCertificateRequest(asn1CSR, ca.parseOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -227,11 +350,17 @@ func (ca *CA) IssueCertificate(asn1CSR []byte, notBefore, notAfter time.Time) ([
 		template.SerialNumber = sn
 	}
 
-	template.SignatureAlgorithm = bifrost.SignatureAlgorithm
+	template.SignatureAlgorithm = ca.sigAlg
 	template.Issuer = ca.cert.Issuer
 	template.Subject.Organization = []string{ca.cert.Namespace.String()}
 	template.Subject.CommonName = csr.PublicKey.UUID(ca.cert.Namespace).String()
 
+	uris, err := ca.identityURIs(csr.ID)
+	if err != nil {
+		return nil, err
+	}
+	template.URIs = append(slices.DeleteFunc(template.URIs, isIdentityURI), uris...)
+
 	certBytes, err := x509.CreateCertificate(
 		rand.Reader,
 		template,
@@ -252,6 +381,37 @@ func (ca *CA) IssueCertificate(asn1CSR []byte, notBefore, notAfter time.Time) ([
 	return certBytes, nil
 }
 
+// IssueIntermediateCertificate issues an intermediate CA certificate for key.
+// The intermediate CA certificate can only issue client certificates,
+// and must be valid within the validity period of the CA certificate.
+func (ca *CA) IssueIntermediateCertificate(
+	key *bifrost.PublicKey,
+	notBefore, notAfter time.Time,
+) ([]byte, error) {
+	if ca.cert.MaxPathLenZero {
+		return nil, errors.New("bifrost: CA certificate cannot issue intermediate CA certificates")
+	}
+	if kt := key.Type(); kt == "" || kt == bifrost.KeyTypeRSA {
+		return nil, fmt.Errorf("bifrost: unsupported intermediate CA key type %T", key.PublicKey)
+	}
+	if notBefore.IsZero() || notAfter.IsZero() || notAfter.Before(notBefore) {
+		return nil, errors.New("bifrost: invalid validity period")
+	}
+	if notBefore.Before(ca.cert.NotBefore) || notAfter.After(ca.cert.NotAfter) {
+		return nil, errors.New("bifrost: validity period exceeds CA certificate validity")
+	}
+
+	template, err := IntermediateCACertTemplate(ca.cert.Namespace, key.UUID(ca.cert.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	template.NotBefore = notBefore
+	template.NotAfter = notAfter
+	template.SignatureAlgorithm = ca.sigAlg
+
+	return x509.CreateCertificate(rand.Reader, template, ca.cert.Certificate, key.PublicKey, ca.key)
+}
+
 // Stop releases resources held by the CA.
 func (ca *CA) Stop() {
 	if ca.gh != nil && ca.gh.wg != nil {
@@ -259,6 +419,42 @@ func (ca *CA) Stop() {
 	}
 }
 
+// identityURIs returns the URI SANs that identify id in certificates issued by the CA.
+func (ca *CA) identityURIs(id uuid.UUID) ([]*url.URL, error) {
+	var uris []*url.URL
+	if ca.trustDomain != "" {
+		u, err := bifrost.SPIFFEID(ca.trustDomain, ca.cert.Namespace, id)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, u)
+	}
+	if ca.uuidURN {
+		uris = append(uris, bifrost.UUIDURN(id))
+	}
+	return uris, nil
+}
+
+// isIdentityURI reports whether u is a SPIFFE ID or urn:uuid URI,
+// which only the CA may set.
+func isIdentityURI(u *url.URL) bool {
+	return u.Scheme == "spiffe" ||
+		(u.Scheme == "urn" && strings.HasPrefix(strings.ToLower(u.Opaque), "uuid:"))
+}
+
+func (ca *CA) rawChain() [][]byte {
+	raw := make([][]byte, 0, len(ca.chain))
+	for _, c := range ca.chain {
+		raw = append(raw, c.Raw)
+	}
+	return raw
+}
+
+func isSelfSigned(cert *bifrost.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignatureFrom(cert.Certificate) == nil
+}
+
 func readCsr(contentType string, body []byte) ([]byte, error) {
 	asn1Data := body
 
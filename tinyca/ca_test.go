@@ -3,14 +3,19 @@ package tinyca
 import (
 	"bytes"
 	"context"
+	"crypto"
+	crand "crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"io"
+	"math/big"
 	"math/rand"
 	"mime"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -202,7 +207,7 @@ FOioc6+qkAh+Sv8CIQDxi4eJOHAg3+eSnryb3zgsDIoGWcw3NRWI12Kwwr9Upw==
 )
 
 func TestCA_ServeHTTP(t *testing.T) {
-	cert, key, err := createCACertKey()
+	cert, key, err := createCACertKey(bifrost.KeyTypeP256)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -294,7 +299,7 @@ func TestCA_ServeHTTP(t *testing.T) {
 }
 
 func TestCA_gauntlet_panic(t *testing.T) {
-	cert, key, err := createCACertKey()
+	cert, key, err := createCACertKey(bifrost.KeyTypeP256)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -332,11 +337,400 @@ func TestCA_gauntlet_panic(t *testing.T) {
 	}
 }
 
-func createCACertKey() (*bifrost.Certificate, *bifrost.PrivateKey, error) {
+func TestCA_IssueCertificate_keyTypes(t *testing.T) {
+	keyTypes := []bifrost.KeyType{
+		bifrost.KeyTypeP256,
+		bifrost.KeyTypeP384,
+		bifrost.KeyTypeEd25519,
+	}
+	for _, caKeyType := range keyTypes {
+		for _, clientKeyType := range keyTypes {
+			t.Run(string(caKeyType)+"/"+string(clientKeyType), func(t *testing.T) {
+				cert, key, err := createCACertKey(caKeyType)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ca, err := New(cert, key, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer ca.Stop()
+
+				clientKey, err := bifrost.GeneratePrivateKey(clientKeyType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				template := bifrost.CertificateRequestTemplate(testNs, clientKey.PublicKey())
+				csr, err := x509.CreateCertificateRequest(crand.Reader, template, clientKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				notBefore := time.Now()
+				certDer, err := ca.IssueCertificate(csr, notBefore, notBefore.Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				clientCert, err := bifrost.ParseCertificate(certDer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !clientCert.IssuedTo(clientKey.PublicKey()) {
+					t.Fatal("certificate was not issued to client key")
+				}
+				if err := clientCert.CheckSignatureFrom(cert.Certificate); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+func TestCA_IssueCertificate_legacyRSA(t *testing.T) {
+	cert, key, err := createCACertKey(bifrost.KeyTypeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := rsa.GenerateKey(crand.Reader, bifrost.MinimumRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := &bifrost.PublicKey{PublicKey: &clientKey.PublicKey}
+	template := bifrost.CertificateRequestTemplate(testNs, pub)
+	csr, err := x509.CreateCertificateRequest(crand.Reader, template, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now()
+	notAfter := notBefore.Add(time.Hour)
+
+	ca, err := New(cert, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	if _, err := ca.IssueCertificate(csr, notBefore, notAfter); !errors.Is(
+		err,
+		bifrost.ErrRequestInvalid,
+	) {
+		t.Fatalf("expected ErrRequestInvalid, got %v", err)
+	}
+
+	legacyCA, err := New(cert, key, nil, WithLegacyRSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacyCA.Stop()
+
+	certDer, err := legacyCA.IssueCertificate(csr, notBefore, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bifrost.ParseCertificate(certDer); err == nil {
+		t.Fatal("expected error parsing RSA certificate without AllowLegacyRSA")
+	}
+	clientCert, err := bifrost.ParseCertificate(certDer, bifrost.AllowLegacyRSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientCert.ID != pub.UUID(testNs) {
+		t.Fatalf("expected ID %s, got %s", pub.UUID(testNs), clientCert.ID)
+	}
+}
+
+// opaqueSigner hides the concrete key type, like a signer backed by an HSM.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestNew_signer(t *testing.T) {
+	cert, key, err := createCACertKey(bifrost.KeyTypeP384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := New(cert, opaqueSigner{key.PrivateKey.(crypto.Signer)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	clientKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := bifrost.CertificateRequestTemplate(testNs, clientKey.PublicKey())
+	csr, err := x509.CreateCertificateRequest(crand.Reader, template, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now()
+	certDer, err := ca.IssueCertificate(csr, notBefore, notBefore.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := bifrost.ParseCertificate(certDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clientCert.CheckSignatureFrom(cert.Certificate); err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(cert, otherKey, nil); err == nil {
+		t.Fatal("expected error for mismatched CA key")
+	}
+
+	// RSA CA keys would sign certificates that bifrost rejects.
+	rsaKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(cert, rsaKey, nil); err == nil ||
+		!strings.Contains(err.Error(), "unsupported CA key type") {
+		t.Fatalf("expected unsupported CA key type error, got %v", err)
+	}
+}
+
+func TestCA_IssueIntermediateCertificate(t *testing.T) {
+	rootCert, rootKey, err := createCACertKey(bifrost.KeyTypeP384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := createCACertKey(bifrost.KeyTypeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := New(rootCert, rootKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Stop()
+	if len(root.Chain()) != 0 {
+		t.Fatalf("expected empty chain for root CA, got %d certificates", len(root.Chain()))
+	}
+
+	intKey, err := bifrost.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := time.Now()
+	if _, err := root.IssueIntermediateCertificate(
+		intKey.PublicKey(), notBefore, notBefore.Add(48*time.Hour),
+	); err == nil {
+		t.Fatal("expected error for validity beyond CA certificate validity")
+	}
+	intDer, err := root.IssueIntermediateCertificate(
+		intKey.PublicKey(), notBefore, notBefore.Add(time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intCert, err := bifrost.ParseCertificate(intDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootCert.MaxPathLen != 1 {
+		t.Fatalf("expected root path length 1, got %d", rootCert.MaxPathLen)
+	}
+	if intCert.MaxPathLen != 0 || !intCert.MaxPathLenZero {
+		t.Fatalf("expected intermediate path length 0, got %d", intCert.MaxPathLen)
+	}
+
+	if _, err := New(intCert, intKey, nil, WithChain(intCert)); err == nil {
+		t.Fatal("expected error for invalid chain")
+	}
+	ca, err := New(intCert, intKey, nil, WithChain(rootCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	if _, err := ca.IssueIntermediateCertificate(
+		intKey.PublicKey(), notBefore, notBefore.Add(time.Hour),
+	); err == nil {
+		t.Fatal("expected intermediate CA to not issue intermediate CA certificates")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(validCsr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	ca.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected code: %d, actual: %d, body: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+
+	var chain []*bifrost.Certificate
+	for b, rest := pem.Decode(rr.Body.Bytes()); b != nil; b, rest = pem.Decode(rest) {
+		c, err := bifrost.ParseCertificate(b.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) != 2 || !chain[1].Equal(intCert.Certificate) {
+		t.Fatalf("expected leaf and intermediate certificates, got %d certificates", len(chain))
+	}
+
+	roots := []*bifrost.Certificate{rootCert}
+	verified, err := chain[0].Verify(roots, chain[1:], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verified) != 3 || !verified[2].Equal(rootCert.Certificate) {
+		t.Fatalf("expected chain to root, got %d certificates", len(verified))
+	}
+	if _, err := chain[0].Verify(roots, nil, time.Now()); !errors.Is(err, bifrost.ErrCertificateInvalid) {
+		t.Fatalf("expected ErrCertificateInvalid without intermediate, got %v", err)
+	}
+	if _, err := chain[0].Verify(roots, chain[1:], time.Now().Add(2*time.Hour)); !errors.Is(
+		err, bifrost.ErrCertificateExpired) {
+		t.Fatalf("expected ErrCertificateExpired after expiry, got %v", err)
+	}
+	if _, err := chain[0].Verify(chain[1:], nil, time.Now()); err != nil {
+		t.Fatalf("expected intermediate to be a trust anchor, got %v", err)
+	}
+	if _, err := chain[0].Verify([]*bifrost.Certificate{cert}, chain[1:], time.Now()); !errors.Is(
+		err, bifrost.ErrCertificateUntrusted) {
+		t.Fatalf("expected ErrCertificateUntrusted, got %v", err)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(validCsr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(webapp.HeaderNameAccept, webapp.MimeTypeBytes)
+	rr = httptest.NewRecorder()
+	ca.ServeHTTP(rr, req)
+	certs, err := x509.ParseCertificates(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[1].Equal(intCert.Certificate) {
+		t.Fatalf("expected leaf and intermediate certificates, got %d certificates", len(certs))
+	}
+}
+
+func TestCACertTemplate_pathLen(t *testing.T) {
+	rootCert, rootKey, err := createCACertKey(bifrost.KeyTypeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// issue returns a certificate for a new key signed by parent.
+	issue := func(
+		template *x509.Certificate,
+		parent *bifrost.Certificate,
+		parentKey *bifrost.PrivateKey,
+	) (*bifrost.Certificate, *bifrost.PrivateKey) {
+		t.Helper()
+		key, err := bifrost.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if template.SerialNumber == nil {
+			template.SerialNumber = big.NewInt(time.Now().UnixNano())
+		}
+		template.Subject.Organization = []string{testNs.String()}
+		template.Subject.CommonName = key.UUID(testNs).String()
+		template.NotBefore = parent.NotBefore
+		template.NotAfter = parent.NotAfter
+		der, err := x509.CreateCertificate(
+			crand.Reader, template, parent.Certificate, key.PublicKey().PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := bifrost.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	newCA := func() *x509.Certificate {
+		t.Helper()
+		template, err := CACertTemplate(testNs, uuid.Nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Intermediates without a path length limit of their own.
+		template.MaxPathLen = -1
+		return template
+	}
+
+	// The root certificate limits chains to one intermediate,
+	// even if the intermediates do not limit them.
+	int1, int1Key := issue(newCA(), rootCert, rootKey)
+	int2, int2Key := issue(newCA(), int1, int1Key)
+	leaf, _ := issue(TLSClientCertTemplate(), int2, int2Key)
+	roots := []*bifrost.Certificate{rootCert}
+	if _, err := leaf.Verify(roots, []*bifrost.Certificate{int1, int2}, time.Now()); !errors.Is(
+		err, bifrost.ErrCertificateInvalid) {
+		t.Fatalf("expected ErrCertificateInvalid for a chain too deep, got %v", err)
+	}
+
+	leaf, _ = issue(TLSClientCertTemplate(), int1, int1Key)
+	if _, err := leaf.Verify(roots, []*bifrost.Certificate{int1}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCA_IssueCertificate_identityURIs(t *testing.T) {
+	cert, key, err := createCACertKey(bifrost.KeyTypeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(cert, key, nil, WithSPIFFEID("Not A Domain")); err == nil {
+		t.Fatal("expected error for invalid trust domain")
+	}
+
+	ca, err := New(cert, key, nil, WithSPIFFEID("example.org"), WithUUIDURN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	block, _ := pem.Decode([]byte(validCsr))
+	notBefore := time.Now()
+	certDer, err := ca.IssueCertificate(block.Bytes, notBefore, notBefore.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td := bifrost.TrustDomains{"example.org": testNs}
+	clientCert, err := bifrost.ParseCertificate(certDer, bifrost.WithTrustDomains(td))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSPIFFE, err := bifrost.SPIFFEID("example.org", testNs, clientCert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientCert.URIs) != 2 ||
+		clientCert.URIs[0].String() != wantSPIFFE.String() ||
+		clientCert.URIs[1].String() != bifrost.UUIDURN(clientCert.ID).String() {
+		t.Fatalf("unexpected URI SANs %v", clientCert.URIs)
+	}
+}
+
+func createCACertKey(kt bifrost.KeyType) (*bifrost.Certificate, *bifrost.PrivateKey, error) {
 	randReader := rand.New(rand.NewSource(42))
 
 	// Create new private key.
-	key, err := bifrost.NewPrivateKey()
+	key, err := bifrost.GeneratePrivateKey(kt)
 	if err != nil {
 		return nil, nil, err
 	}
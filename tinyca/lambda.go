@@ -0,0 +1,227 @@
+package tinyca
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RealImage/bifrost/internal/webapp"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// LambdaHandler returns an AWS Lambda handler that serves h, such as a ServeMux with
+// the CA's routes added by [CA.AddRoutes], to proxy events from API Gateway REST APIs,
+// API Gateway HTTP APIs, and Lambda Function URLs.
+// Use it with lambda.Start.
+//
+// Base64 encoded request bodies are decoded. Responses that are not text, such as
+// application/octet-stream certificates, are base64 encoded.
+func LambdaHandler(h http.Handler) func(context.Context, json.RawMessage) (any, error) {
+	return func(ctx context.Context, event json.RawMessage) (any, error) {
+		var probe struct {
+			Version    string `json:"version"`
+			HTTPMethod string `json:"httpMethod"`
+		}
+		if err := json.Unmarshal(event, &probe); err != nil {
+			return nil, fmt.Errorf("error decoding lambda event: %w", err)
+		}
+
+		switch {
+		case probe.Version == "2.0":
+			// HTTP API payload version 2.0 and Function URL events share a format.
+			var req events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(event, &req); err != nil {
+				return nil, fmt.Errorf("error decoding lambda event: %w", err)
+			}
+			return serveV2HTTP(ctx, h, &req)
+		case probe.HTTPMethod != "":
+			var req events.APIGatewayProxyRequest
+			if err := json.Unmarshal(event, &req); err != nil {
+				return nil, fmt.Errorf("error decoding lambda event: %w", err)
+			}
+			return serveProxy(ctx, h, &req)
+		}
+		return nil, errors.New("unsupported lambda event, expected an HTTP proxy event")
+	}
+}
+
+func serveProxy(
+	ctx context.Context,
+	h http.Handler,
+	event *events.APIGatewayProxyRequest,
+) (*events.APIGatewayProxyResponse, error) {
+	query := make(url.Values)
+	for k, vs := range event.MultiValueQueryStringParameters {
+		query[k] = vs
+	}
+	if len(query) == 0 {
+		for k, v := range event.QueryStringParameters {
+			query.Set(k, v)
+		}
+	}
+
+	header := make(http.Header)
+	for k, vs := range event.MultiValueHeaders {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	if len(header) == 0 {
+		for k, v := range event.Headers {
+			header.Set(k, v)
+		}
+	}
+
+	r, err := newLambdaRequest(ctx, event.HTTPMethod, event.Path, query.Encode(),
+		header, event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = net.JoinHostPort(event.RequestContext.Identity.SourceIP, "0")
+	if r.Host == "" {
+		r.Host = event.RequestContext.DomainName
+	}
+
+	w := newLambdaResponseWriter()
+	h.ServeHTTP(w, r)
+	body, isBase64 := w.encodedBody()
+	return &events.APIGatewayProxyResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}, nil
+}
+
+func serveV2HTTP(
+	ctx context.Context,
+	h http.Handler,
+	event *events.APIGatewayV2HTTPRequest,
+) (*events.APIGatewayV2HTTPResponse, error) {
+	header := make(http.Header)
+	for k, v := range event.Headers {
+		header.Set(k, v)
+	}
+	if len(event.Cookies) != 0 {
+		header.Set("Cookie", strings.Join(event.Cookies, "; "))
+	}
+
+	path := event.RawPath
+	if path == "" {
+		path = event.RequestContext.HTTP.Path
+	}
+	r, err := newLambdaRequest(ctx, event.RequestContext.HTTP.Method, path, event.RawQueryString,
+		header, event.Body, event.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = net.JoinHostPort(event.RequestContext.HTTP.SourceIP, "0")
+	if r.Host == "" {
+		r.Host = event.RequestContext.DomainName
+	}
+
+	w := newLambdaResponseWriter()
+	h.ServeHTTP(w, r)
+	body, isBase64 := w.encodedBody()
+	cookies := w.header.Values("Set-Cookie")
+	w.header.Del("Set-Cookie")
+	headers := make(map[string]string, len(w.header))
+	for k, vs := range w.header {
+		headers[k] = strings.Join(vs, ",")
+	}
+	return &events.APIGatewayV2HTTPResponse{
+		StatusCode:      w.status,
+		Headers:         headers,
+		Cookies:         cookies,
+		Body:            body,
+		IsBase64Encoded: isBase64,
+	}, nil
+}
+
+func newLambdaRequest(
+	ctx context.Context,
+	method, path, rawQuery string,
+	header http.Header,
+	body string,
+	isBase64 bool,
+) (*http.Request, error) {
+	data := []byte(body)
+	if isBase64 {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(body); err != nil {
+			return nil, fmt.Errorf("error decoding base64 request body: %w", err)
+		}
+	}
+
+	u := &url.URL{Path: path, RawQuery: rawQuery}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = header
+	r.Host = header.Get("Host")
+	r.RequestURI = u.RequestURI()
+	return r, nil
+}
+
+// lambdaResponseWriter buffers a response to a Lambda proxy event.
+type lambdaResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newLambdaResponseWriter() *lambdaResponseWriter {
+	return &lambdaResponseWriter{header: make(http.Header)}
+}
+
+func (w *lambdaResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lambdaResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// encodedBody returns the response body, base64 encoded unless it is text.
+// It sets the status and content type if the handler did not.
+func (w *lambdaResponseWriter) encodedBody() (string, bool) {
+	w.WriteHeader(http.StatusOK)
+	body := w.body.Bytes()
+	if w.header.Get(webapp.HeaderNameContentType) == "" && len(body) != 0 {
+		w.header.Set(webapp.HeaderNameContentType, http.DetectContentType(body))
+	}
+
+	if isText(w.header.Get(webapp.HeaderNameContentType)) && utf8.Valid(body) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+func isText(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || mt == "application/json" ||
+		strings.HasSuffix(mt, "+json") || mt == "application/x-pem-file"
+}
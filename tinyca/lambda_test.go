@@ -0,0 +1,144 @@
+package tinyca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RealImage/bifrost"
+	"github.com/RealImage/bifrost/internal/webapp"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLambdaHandler(t *testing.T) {
+	caCert, caKey, err := createCACertKey(bifrost.KeyTypeP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := New(caCert, caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+	mux := http.NewServeMux()
+	ca.AddRoutes(mux, false)
+	handler := LambdaHandler(mux)
+
+	block, _ := pem.Decode([]byte(validCsr))
+	csrDer := block.Bytes
+
+	invoke := func(t *testing.T, event any) any {
+		t.Helper()
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := handler(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("http api namespace", func(t *testing.T) {
+		event := events.APIGatewayV2HTTPRequest{
+			Version: "2.0",
+			RawPath: "/namespace",
+			Headers: map[string]string{"host": "ca.example.com"},
+			Cookies: []string{"a=b"},
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+					Method:   http.MethodGet,
+					Path:     "/namespace",
+					SourceIP: "203.0.113.10",
+				},
+			},
+		}
+		resp := invoke(t, event).(*events.APIGatewayV2HTTPResponse)
+		if resp.StatusCode != http.StatusOK || resp.IsBase64Encoded {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+		if resp.Body != testNs.String() {
+			t.Fatalf("expected namespace %s, got %s", testNs, resp.Body)
+		}
+	})
+
+	t.Run("function url pem", func(t *testing.T) {
+		event := events.LambdaFunctionURLRequest{
+			Version: "2.0",
+			RawPath: "/issue",
+			Headers: map[string]string{"content-type": webapp.MimeTypeText},
+			Body:    base64.StdEncoding.EncodeToString([]byte(validCsr)),
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				DomainName: "abc.lambda-url.us-east-1.on.aws",
+				HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+					Method:   http.MethodPost,
+					Path:     "/issue",
+					SourceIP: "203.0.113.10",
+				},
+			},
+			IsBase64Encoded: true,
+		}
+		resp := invoke(t, event).(*events.APIGatewayV2HTTPResponse)
+		if resp.StatusCode != http.StatusOK || resp.IsBase64Encoded {
+			t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Body)
+		}
+		block, _ := pem.Decode([]byte(resp.Body))
+		if block == nil || block.Type != "CERTIFICATE" {
+			t.Fatalf("expected PEM certificate, got %s", resp.Body)
+		}
+	})
+
+	t.Run("rest api der", func(t *testing.T) {
+		event := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/issue",
+			MultiValueHeaders: map[string][]string{
+				"Content-Type": {webapp.MimeTypeBytes},
+				"Accept":       {webapp.MimeTypeBytes},
+			},
+			MultiValueQueryStringParameters: map[string][]string{"not-after": {"+30m"}},
+			Body:                            base64.StdEncoding.EncodeToString(csrDer),
+			IsBase64Encoded:                 true,
+		}
+		resp := invoke(t, event).(*events.APIGatewayProxyResponse)
+		if resp.StatusCode != http.StatusOK || !resp.IsBase64Encoded {
+			t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Body)
+		}
+		der, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, err := x509.ParseCertificates(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(certs) != 1 {
+			t.Fatalf("expected 1 certificate, got %d", len(certs))
+		}
+		if d := certs[0].NotAfter.Sub(certs[0].NotBefore); d > 30*time.Minute {
+			t.Fatalf("expected validity of at most 30m, got %s", d)
+		}
+	})
+
+	t.Run("rest api not found", func(t *testing.T) {
+		event := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/nope",
+			Headers:    map[string]string{"Accept": "*/*"},
+		}
+		resp := invoke(t, event).(*events.APIGatewayProxyResponse)
+		if resp.StatusCode != http.StatusNotFound || resp.IsBase64Encoded {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+	})
+
+	if _, err := handler(context.Background(), []byte(`{"Records":[]}`)); err == nil {
+		t.Fatal("expected error for unsupported event")
+	}
+}
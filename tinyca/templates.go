@@ -19,7 +19,9 @@ func TLSClientCertTemplate() *x509.Certificate {
 	}
 }
 
-// CACertTemplate returns a new x509.Certificate template for a CA certificate.
+// CACertTemplate returns a new x509.Certificate template for a root CA certificate.
+// Root CA certificates can issue intermediate CA certificates, but not deeper chains,
+// because their path length is limited to one.
 func CACertTemplate(ns, id uuid.UUID) (*x509.Certificate, error) {
 	serialNumber, err := rand.Int(rand.Reader, big.NewInt(int64(math.MaxInt64)))
 	if err != nil {
@@ -34,6 +36,19 @@ func CACertTemplate(ns, id uuid.UUID) (*x509.Certificate, error) {
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
-		MaxPathLenZero:        true,
+		MaxPathLen:            1,
 	}, nil
 }
+
+// IntermediateCACertTemplate returns a new x509.Certificate template for an
+// intermediate CA certificate.
+// Intermediate CA certificates can only issue client certificates.
+func IntermediateCACertTemplate(ns, id uuid.UUID) (*x509.Certificate, error) {
+	template, err := CACertTemplate(ns, id)
+	if err != nil {
+		return nil, err
+	}
+	template.MaxPathLen = 0
+	template.MaxPathLenZero = true
+	return template, nil
+}